@@ -0,0 +1,96 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Load default options from a JSON file
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// long config keys -> flag names, any flag name works as a key as well
+var configKeys = map[string]string{
+	"in":    "i",
+	"out":   "o",
+	"ext":   "e",
+	"depth": "d",
+}
+
+// separators to join a list of strings given for a flag
+var configLists = map[string]string{
+	"i":           ",",
+	"e":           "|",
+	"x":           "|",
+	"systemfiles": "|",
+}
+
+/*
+ * Load options from a JSON file like {"in": ["photos", "scans"], "out": "sorted", "move": true}
+ * values are applied with flag.Set, so they're checked like command line arguments,
+ * flags given on the command line are left untouched
+ */
+func loadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	// flags given on the command line win over the file, along with their aliases, e.g. -move sets the value of -m
+	var set = make(map[flag.Value]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Value] = true
+	})
+	for key, value := range values {
+		var name string = key
+		if alias, ok := configKeys[key]; ok {
+			name = alias
+		}
+		if flag.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s: unknown option %q", path, key)
+		}
+		if set[flag.Lookup(name).Value] {
+			continue
+		}
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case bool:
+			s = strconv.FormatBool(v)
+		case float64: // JSON numbers, written out in full so integer flags take e.g. 1000000
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case []interface{}:
+			sep, ok := configLists[name]
+			if !ok {
+				return fmt.Errorf("%s: option %q doesn't take a list", path, key)
+			}
+			var items []string
+			for _, item := range v {
+				str, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("%s: option %q must be a list of strings", path, key)
+				}
+				items = append(items, str)
+			}
+			s = strings.Join(items, sep)
+		default:
+			return fmt.Errorf("%s: invalid value for option %q", path, key)
+		}
+		err = flag.Set(name, s)
+		if err != nil {
+			return fmt.Errorf("%s: option %q: %s", path, key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of loading options from a JSON file
+ */
+
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Parse args with fresh flags, then fill in the rest from a config file holding data
+ */
+func parseWithConfig(t *testing.T, data string, args ...string) error {
+	t.Helper()
+	flag.CommandLine = flag.NewFlagSet("imo", flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	initOpts()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	var path string = filepath.Join(t.TempDir(), "imo.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return loadConfig(path)
+}
+
+func TestConfigAliases(t *testing.T) {
+	// an alias on the command line wins over the flag's other name in the file
+	var tests = []struct {
+		args []string
+		data string
+		opt  *bool
+	}{
+		{[]string{"-move"}, `{"m": false}`, &optMove},
+		{[]string{"-m"}, `{"move": false}`, &optMove},
+		{[]string{"-force"}, `{"f": false}`, &optForce},
+		{[]string{"-yes"}, `{"y": false}`, &optYes},
+		{[]string{"-lowerext"}, `{"normext": false}`, &optNormExt},
+	}
+	for _, tt := range tests {
+		if err := parseWithConfig(t, tt.data, tt.args...); err != nil {
+			t.Fatal(err)
+		}
+		if !*tt.opt {
+			t.Errorf("%v overridden by %s", tt.args, tt.data)
+		}
+	}
+	// the file still fills in what isn't given
+	if err := parseWithConfig(t, `{"move": true, "f": true}`, "-y"); err != nil {
+		t.Fatal(err)
+	}
+	if !optMove || !optForce || !optYes {
+		t.Errorf("move %v, force %v, yes %v, want all true", optMove, optForce, optYes)
+	}
+}
+
+func TestConfigNumbers(t *testing.T) {
+	// JSON numbers reach integer flags in full, not as 1e+06
+	if err := parseWithConfig(t, `{"minsize": 1000000, "depth": 3, "j": 16, "seed": 12345678901}`); err != nil {
+		t.Fatal(err)
+	}
+	if optMinSize != "1000000" || optDepth != 3 || optJobs != 16 || optSeed != 12345678901 {
+		t.Errorf("minsize %q, depth %d, jobs %d, seed %d, want 1000000, 3, 16, 12345678901", optMinSize, optDepth, optJobs, optSeed)
+	}
+	if err := parseWithConfig(t, `{"depth": 1.5}`); err == nil {
+		t.Error("no error for a fraction given to -d")
+	}
+}
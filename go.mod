@@ -0,0 +1,5 @@
+module github.com/real-benjamin-lee/image-organizer
+
+go 1.21
+
+require golang.org/x/image v0.24.0
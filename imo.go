@@ -7,14 +7,25 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/real-benjamin-lee/image-organizer/organizer"
 )
 
 // version
@@ -23,25 +34,97 @@ const VER_MIN int = 0 // minor
 const VER_REV int = 0 // revision
 
 // options
-var optIn string       // input directory
-var optOut string      // output directory
-var optExt string      // file extensions
-var optDepth int       // search depth
-var optVerboseErr bool // show error messages
-var optVerboseAll bool // show all messages
-var optScanOnly bool   // scan without copy
-
-// runtime variables
-var id int = 0      // image ID
-var found int = 0   // qualified files
-var copied int = 0  // files copied
-var extArr []string // split optExt into string array
-
-// error counters
-var failed int = 0            // failed operations
-var dirError int = 0          // failed to read from directory
-var copyError int = 0         // failed to copy
-var depthLimitReached int = 0 // stopped by maximum depth, you may want to raise the value of -d to do a deeper search
+var optConfig string         // JSON file with default options
+var optIn string             // input directories, separated by ","
+var optOut string            // output directory
+var optExt string            // file extensions
+var optExclude string        // file extensions to exclude
+var optSystemFiles string    // further names of system files to skip
+var optHidden bool           // take hidden files and directories as well
+var optPreset string         // name of a curated extension list
+var optVideo bool            // search videos as well
+var optExtFile string        // file listing extensions to search
+var optDepth int             // search depth
+var optMinDepth int          // skip files shallower than this depth
+var optNoRecurse bool        // don't descend into sub-directories
+var optSort string           // order of files within each directory
+var optFollow bool           // follow symlinked directories
+var optLogLevel int          // log level, see LOG_*
+var optVerboseErr bool       // show error messages, same as -loglevel 1
+var optVerboseAll bool       // show all messages, same as -loglevel 2
+var optLogFormat string      // plain, text or json
+var optScanOnly bool         // scan without copy
+var optStats bool            // count files per extension without copy
+var optPlan bool             // scan without copy, list files not yet in output directory
+var optHistogram bool        // scan without copy, chart files per day taken
+var optMove bool             // delete source files after copy
+var optPrune bool            // remove source directories emptied by -m
+var optKeepEmpty bool        // create directories without images with -tree
+var optConfirm bool          // ask before copying what a scan found
+var optYes bool              // answer -confirm with yes
+var optKeep bool             // keep original filenames instead of sequential IDs
+var optAppend bool           // add to an output directory that isn't empty
+var optForce bool            // overwrite existing destination files
+var optDedup bool            // skip files whose content has already been copied
+var optHashName bool         // name copies after their content hash
+var optNewest bool           // only copy the newest of files with the same name
+var optNoTime bool           // don't preserve modification times
+var optNoPerm bool           // don't preserve permission bits
+var optRetries int           // retries of copies failing with transient errors
+var optJobs int              // number of copy workers
+var optScanJobs int          // number of directories read in parallel
+var optRateLimit string      // copy bandwidth limit, e.g. 10MB/s
+var optBufSize string        // copy buffer size per worker, e.g. 1MB
+var optPrefix bool           // prefix filenames with parent folder name
+var optParents int           // prefix filenames with this many parent folder names
+var optName string           // base of sequential names
+var optMinSize string        // minimum file size, e.g. 100KB
+var optMinDim string         // minimum image dimensions, e.g. 1920x1080
+var optKeepNoDim bool        // take files whose dimensions can't be read with -mindim
+var optAllowEmptyFiles bool  // take zero-byte files as well
+var optMatch string          // regular expression filenames must match
+var optNoMatch string        // regular expression filenames must not match
+var optSince string          // skip files modified before this date
+var optUntil string          // skip files modified after this date
+var optSniff bool            // detect image type by content instead of extension
+var optByDate bool           // sort copies into YYYY/MM sub-folders
+var optTree bool             // keep directory structure of input
+var optFlatDepth int         // directory levels to keep below each input
+var optByExt bool            // sort copies into sub-folders per extension
+var optStructure string      // sub-folders by a template with placeholders
+var optNormExt bool          // one extension spelling per type
+var optIDPerExt bool         // count IDs per extension
+var optManifest string       // CSV file recording every copy
+var optCommands bool         // print shell commands instead of copying
+var optUndo string           // manifest of a run to undo
+var optCheck string          // manifest whose copies to verify
+var optErrLog string         // file every error is appended to
+var optStrict bool           // treat reaching maximum depth as a failure
+var optAllowEmpty bool       // exit with 0 if nothing was found
+var optPad int               // zero-pad IDs to this width
+var optTemplate string       // filename template with placeholders
+var optThumb string          // thumbnail size, e.g. 320x240
+var optAutoRotate bool       // turn JPEG photos upright according to EXIF orientation
+var optQuality int           // JPEG quality of re-encoded photos
+var optConvert string        // format to convert images to
+var optCollision string      // suffix of kept names that are taken
+var optLink bool             // create hard links instead of copies
+var optVerify bool           // compare checksums of source and copy
+var optXattrs bool           // copy extended attributes
+var optSidecars bool         // copy .xmp and .aae files along
+var optGallery bool          // write index.html of the copies into the output directory
+var optNoProgress bool       // don't show progress line
+var optQuiet bool            // don't print the summary
+var optState string          // file recording copied sources to resume from
+var optSummary bool          // print the summary only, no line per file
+var optJSON bool             // print the summary as JSON
+var optMaxFiles int          // stop after this many files, 0 = no limit
+var optSample int            // take this many files picked at random, 0 = all
+var optSeed int64            // seed of the random picks of -sample
+var optTimeout time.Duration // stop after this long, 0 = no limit
+var optNoCheck bool          // don't check free space before copying
+var optMinFree int           // percentage of the output filesystem to keep free
+var optIgnoreFile string     // file with ignore patterns, defaults to .imoignore in each input directory
 
 /*
  * Initialize options
@@ -49,122 +132,272 @@ var depthLimitReached int = 0 // stopped by maximum depth, you may want to raise
  * @see https://golang.org/pkg/flag/
  */
 func initOpts() {
-	flag.StringVar(&optIn, "i", ".", "input directory")
+	flag.StringVar(&optConfig, "config", "", "JSON file with default options, flags on the command line win")
+	flag.StringVar(&optIn, "i", ".", "input directories, separated by \",\"")
 	flag.StringVar(&optOut, "o", "image-organizer", "output directory")
 	flag.StringVar(&optExt, "e", "jpg|jpeg|png|bmp", "file extensions")
-	flag.IntVar(&optDepth, "d", 10, "search depth")
-	flag.BoolVar(&optVerboseErr, "v", false, "show error log")
-	flag.BoolVar(&optVerboseAll, "vv", false, "show error and message logs")
+	flag.StringVar(&optExtFile, "extfile", "", "read extensions to search from this file, one per line or |-separated, merged with -e if given")
+	flag.BoolVar(&optVideo, "video", false, "search videos as well, adds mp4|mov|avi|mkv|m4v|3gp to -e or -preset")
+	flag.StringVar(&optPreset, "preset", "", "curated extension list: common, raw, video or all, merged with -e if given")
+	flag.StringVar(&optExclude, "x", "", "file extensions to exclude, e.g. gif|bmp, wins over -e")
+	flag.BoolVar(&optHidden, "hidden", false, "take hidden files and directories as well, names starting with a dot")
+	flag.StringVar(&optSystemFiles, "systemfiles", "", "further names of system files and directories to skip, e.g. .picasa.ini|@eaDir, case-insensitive")
+	flag.IntVar(&optDepth, "d", 10, "search depth, 0 = unlimited")
+	flag.IntVar(&optMinDepth, "mindepth", 0, "skip files shallower than this depth, 0 = files right under input directory")
+	flag.BoolVar(&optNoRecurse, "norecurse", false, "only take files right under the input directory, not those in sub-directories, overrides -d")
+	flag.StringVar(&optSort, "sort", "name", "order of files within each directory, name, mtime (oldest first) or size (smallest first)")
+	flag.BoolVar(&optFollow, "L", false, "follow symlinked directories, they're skipped by default")
+	flag.IntVar(&optLogLevel, "loglevel", organizer.LOG_QUIET, "log level, 0 = quiet, 1 = errors, 2 = info, 3 = debug")
+	flag.BoolVar(&optVerboseErr, "v", false, "show error log, same as -loglevel 1")
+	flag.BoolVar(&optVerboseAll, "vv", false, "show error and message logs, same as -loglevel 2")
+	flag.StringVar(&optLogFormat, "logformat", "plain", "log format, plain, or text (key=value) and json for structured records on stderr")
 	flag.BoolVar(&optScanOnly, "s", false, "search without copy")
+	flag.BoolVar(&optStats, "stats", false, "search without copy, count files and size per extension regardless of -e")
+	flag.BoolVar(&optPlan, "plan", false, "search without copy, list files whose content (SHA-256) isn't in output directory yet")
+	flag.BoolVar(&optHistogram, "histogram", false, "search without copy, chart files per day taken (EXIF date or modification time)")
+	flag.BoolVar(&optMove, "m", false, "move files, delete source after a successful copy")
+	flag.BoolVar(&optMove, "move", false, "same as -m")
+	flag.BoolVar(&optPrune, "prune", false, "with -m, remove source directories left empty afterwards")
+	flag.BoolVar(&optKeepEmpty, "keepempty", false, "with -tree, create every directory of the input, even those without images")
+	flag.BoolVar(&optConfirm, "confirm", false, "search first and ask before copying what was found")
+	flag.BoolVar(&optYes, "y", false, "don't ask with -confirm, e.g. in scripts")
+	flag.BoolVar(&optYes, "yes", false, "same as -y")
+	flag.BoolVar(&optKeep, "keep", false, "keep original filenames, add -1, -2, ... on collision")
+	flag.BoolVar(&optAppend, "append", false, "add to an output directory that isn't empty, e.g. to update it or resume with -state")
+	flag.BoolVar(&optForce, "f", false, "overwrite existing destination files")
+	flag.BoolVar(&optForce, "force", false, "same as -f")
+	flag.BoolVar(&optDedup, "dedup", false, "skip files with identical content (SHA-256)")
+	flag.BoolVar(&optHashName, "hashname", false, "name copies after their content (SHA-256), e.g. a1b2c3d4e5f60718.jpg, implies -dedup")
+	flag.BoolVar(&optNewest, "newest", false, "with -keep, -tree or -template, only copy the newest of files with the same name, replacing older copies")
+	flag.BoolVar(&optNoTime, "notime", false, "don't preserve modification times of copied files")
+	flag.BoolVar(&optNoPerm, "noperm", false, "don't preserve permission bits of copied files, create them with 0644")
+	flag.IntVar(&optRetries, "retries", 2, "retry copies failing with transient I/O errors this many times, with a growing pause")
+	flag.IntVar(&optJobs, "j", runtime.NumCPU(), "number of parallel copy workers")
+	flag.IntVar(&optScanJobs, "scanjobs", 1, "number of directories read ahead in parallel, e.g. 8 on a network share")
+	flag.StringVar(&optRateLimit, "ratelimit", "", "limit copy bandwidth of all workers together, e.g. 10MB/s")
+	flag.StringVar(&optBufSize, "bufsize", "1MB", "copy buffer size per worker, e.g. 256KB, 4MB")
+	flag.IntVar(&optPad, "pad", 0, "zero-pad IDs to this width, e.g. 4 for 0001.jpg")
+	flag.StringVar(&optTemplate, "template", "", "filename template, e.g. {parent}_{date}_{seq}{ext} or {camera}_{iso}_{date}{ext}, overrides -keep and -prefix")
+	flag.StringVar(&optThumb, "thumb", "", "write JPEG and PNG images as thumbnails fitting into WxH, e.g. 320x240, instead of copies")
+	flag.BoolVar(&optAutoRotate, "autorotate", false, "turn JPEG photos upright according to their EXIF orientation, others are copied as they are")
+	flag.IntVar(&optQuality, "quality", organizer.DefaultQuality, "JPEG quality of photos re-encoded by -autorotate or -convert, 1 to 100")
+	flag.StringVar(&optCollision, "collision", "number", "suffix of kept names that are taken, number (foo-1.jpg) or hash (foo-a1b2c3d4.jpg, identical files are copied once)")
+	flag.StringVar(&optConvert, "convert", "", "re-encode JPEG, PNG, GIF and BMP images to jpg or png, others are copied as they are")
+	flag.BoolVar(&optLink, "link", false, "create hard links instead of copies, falls back to copy across devices")
+	flag.BoolVar(&optVerify, "verify", false, "compare SHA-256 of source and copy, remove copies that differ")
+	flag.BoolVar(&optGallery, "gallery", false, "write an index.html into the output directory with a grid of the images copied by this run")
+	flag.BoolVar(&optSidecars, "sidecars", false, "copy .xmp and .aae files of the same name along with each image, named like its copy")
+	flag.BoolVar(&optXattrs, "xattrs", false, "copy extended attributes (Linux and macOS only), e.g. ratings and tags")
+	flag.BoolVar(&optNoProgress, "noprogress", false, "don't show progress line")
+	flag.BoolVar(&optJSON, "json", false, "print the summary as a JSON object, log messages go to stderr")
+	flag.StringVar(&optState, "state", "", "record copied files in this file and skip those unchanged since on the next run, e.g. to resume an interrupted run")
+	flag.BoolVar(&optSummary, "summary", false, "print the summary but no line per file, even with -vv or -q, errors still go to stderr")
+	flag.BoolVar(&optQuiet, "q", false, "quiet, don't print the summary and progress line, errors still go to stderr")
+	flag.IntVar(&optMaxFiles, "maxfiles", 0, "stop after copying (or listing with -s) this many files, 0 = no limit")
+	flag.IntVar(&optSample, "sample", 0, "only copy (or list with -s) this many of the files found, picked at random, 0 = all")
+	flag.Int64Var(&optSeed, "seed", 0, "seed of the random picks of -sample, the same seed picks the same files again, 0 = time-based")
+	flag.DurationVar(&optTimeout, "timeout", 0, "stop after this long, e.g. 30m, copies in progress are removed, 0 = no limit")
+	flag.StringVar(&optName, "name", "", "base of sequential names, e.g. photo for photo_1.jpg, combine with -pad for photo_0001.jpg")
+	flag.BoolVar(&optPrefix, "prefix", false, "prefix filenames with parent folder name, e.g. vacation_1.jpg")
+	flag.IntVar(&optParents, "parents", 0, "prefix filenames with this many parent folder names, e.g. 3 for 2023-Italy-Rome_1.jpg")
+	flag.StringVar(&optMinSize, "minsize", "0", "skip files smaller than this size, e.g. 100KB, 2MB")
+	flag.StringVar(&optMinDim, "mindim", "", "skip images smaller than WxH pixels, e.g. 1920x1080, 0 for no limit on a side")
+	flag.BoolVar(&optKeepNoDim, "mindim-keep", false, "with -mindim, take files whose dimensions can't be read, e.g. RAW or HEIC, instead of skipping them")
+	flag.BoolVar(&optAllowEmptyFiles, "allow-empty-files", false, "take zero-byte files as well, by default they're skipped")
+	flag.StringVar(&optMatch, "match", "", "only take files whose name matches this regular expression, e.g. ^IMG_\\d+")
+	flag.StringVar(&optSince, "since", "", "skip files modified before this date, YYYY-MM-DD or RFC3339")
+	flag.StringVar(&optUntil, "until", "", "skip files modified after this date, YYYY-MM-DD (the whole day) or RFC3339")
+	flag.StringVar(&optNoMatch, "nomatch", "", "skip files whose name matches this regular expression")
+	flag.BoolVar(&optSniff, "sniff", false, "detect image type by content instead of extension")
+	flag.BoolVar(&optByDate, "bydate", false, "sort copies into YYYY/MM folders by EXIF date or modification time")
+	flag.BoolVar(&optNoCheck, "nocheck", false, "don't check free space of output directory before copying")
+	flag.IntVar(&optMinFree, "minfree", 0, "stop before a copy would leave less than this percentage of the output filesystem free, 0 for no limit")
+	flag.BoolVar(&optTree, "tree", false, "keep the directory structure of the input instead of flattening, with original filenames")
+	flag.IntVar(&optFlatDepth, "flattendepth", 0, "keep this many directory levels of the input, e.g. 1 for a folder per album, and flatten the rest")
+	flag.BoolVar(&optByExt, "byext", false, "sort copies into folders named after their extension, e.g. jpg/, png/")
+	flag.StringVar(&optStructure, "structure", "", "sort copies into folders by a template, e.g. {year}/{month}/{ext}, placeholders like -template, replaces -bydate and -byext")
+	flag.BoolVar(&optNormExt, "normext", false, "name copies .jpg for .jpeg, .jpe and .jfif, .tiff for .tif")
+	flag.BoolVar(&optNormExt, "lowerext", false, "same as -normext")
+	flag.BoolVar(&optIDPerExt, "extid", false, "count IDs per extension, e.g. 1.jpg, 2.jpg, 1.png, instead of across all files")
+	flag.StringVar(&optIgnoreFile, "ignorefile", "", "file with ignore patterns (default .imoignore in input directory)")
+	flag.BoolVar(&optStrict, "strict", false, "exit with failure if maximum depth was reached")
+	flag.BoolVar(&optAllowEmpty, "allow-empty", false, "exit with 0 instead of 7 if no files were found")
+	flag.BoolVar(&optCommands, "print-commands", false, "print shell-quoted mkdir and cp (mv with -m) commands to stdout instead of copying, without summary")
+	flag.StringVar(&optManifest, "manifest", "", "write source, destination, size and SHA-256 of every copy to this CSV file")
+	flag.StringVar(&optErrLog, "errlog", "", "append every error with the files concerned to this file, whatever -loglevel is")
+	flag.StringVar(&optCheck, "check", "", "verify the copies recorded in this manifest by size and SHA-256 instead of searching, nothing is copied")
+	flag.StringVar(&optUndo, "undo", "", "remove the copies recorded in this manifest instead of searching, unchanged ones only, with -m move them back")
 }
 
 /*
- * Process a given directory
- * @param from	search this directory for images
- * @param to    once found, copy image to this directory
- * @param depth stop when exceeding optDepth
+ * Read extensions from a file given by -extfile
+ * one per line or several separated by "|", blank lines and lines starting with "#" are skipped,
+ * extensions are lowercased and a leading dot is dropped, so ".JPG" works as well
  */
-func processDir(from string, to string, depth int) {
-	// stop if we've reached maximum depth
-	if depth > optDepth {
-		depthLimitReached++ // record this incident
-		return
+func loadExtFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var exts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, ext := range strings.Split(line, "|") {
+			ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+			if ext != "" {
+				exts = append(exts, ext)
+			}
+		}
 	}
-	// don't copy to itself
-	if from == to {
-		return
+	if len(exts) == 0 {
+		return nil, fmt.Errorf("%s: no extensions found", path)
 	}
-	// scan directory specified by from
-	// @see https://golang.org/pkg/io/ioutil/#ReadDir
-	files, err := ioutil.ReadDir(from)
-	// if we encounter an directory error, this would likely to be
-	// 1. directory not exist
-	// 2. directory permissions
-	// TODO: show suggestions depending on different errors
+	return organizer.MergeExt(exts), nil
+}
+
+/*
+ * Parse dimensions like "320x240"
+ * @return false if it's not two numbers separated by "x"
+ */
+func parseDim(dim string) (int, int, bool) {
+	var w, h, found = strings.Cut(strings.ToLower(dim), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	return width, height, found && errW == nil && errH == nil
+}
+
+/*
+ * Check whether a file is a terminal
+ */
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+/*
+ * Check whether a directory holds nothing but system files like .DS_Store
+ * a directory that can't be read counts as empty, copies into it report the error
+ * @param system further names given by -systemfiles
+ */
+func isEmptyDir(dir string, system []string) bool {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		dirError++ // record this incident
-		failed++
-		if optVerboseErr || optVerboseAll { // TODO: replace by log level in integer
-			fmt.Fprintln(os.Stderr, err.Error())
+		return true
+	}
+	var names = make(map[string]bool, len(organizer.DefaultSystemFiles)+len(system)) // lowercase
+	for _, list := range [][]string{organizer.DefaultSystemFiles, system} {
+		for _, name := range list {
+			names[strings.ToLower(name)] = true
 		}
-		return
-	}
-	// if we successfully read the directory,
-	// parse its files/sub-directories
-	for _, file := range files {
-		if file.IsDir() { // if we find a directory, search it
-			processDir(filepath.Join(from, file.Name()), to, depth+1)
-		} else { // if we find a file, get its properties
-			var filename string = file.Name()                        // get filename
-			var ext string = strings.ToLower(filepath.Ext(filename)) // convert extension to lowercase for easier filtering
-			// exclude system files
-			if filename == ".DS_STORE" || filename == "thumb.db" || filename == "Thumb.db" {
-				continue
-			}
-			// filter extension
-			var validExt bool = false // valid extension flag
-			for i := 0; i < len(extArr); i++ {
-				if "."+extArr[i] == ext {
-					validExt = true
-					break // don't need to check the rest if we've got a correct one
-				}
-			}
-			if validExt { // if extension is valid
-				found++ // record this incident
-			} else {
+	}
+	for _, entry := range entries {
+		if !names[strings.ToLower(entry.Name())] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Show a progress line with counters and throughput until stop is closed
+ * the line is cleared before done is closed
+ * @param current returns the latest counters reported by organizer.Config.Progress
+ */
+func progress(current func() organizer.Result, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	var start time.Time = time.Now()
+	var width int = 0 // length of the longest line so far, to clear it
+	var ticker = time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			fmt.Print("\r" + strings.Repeat(" ", width) + "\r")
+			return
+		case <-ticker.C:
+			var res organizer.Result = current()
+			if res.Found == 0 { // nothing to show yet, e.g. while -confirm asks
 				continue
 			}
-			if optScanOnly { // skip copy if -s is enabled
-				if optVerboseAll { // TODO: replace by log level
-					fmt.Println(filepath.Join(from, filename))
-				}
-				continue
+			var found, copied string = strconv.Itoa(res.Found), strconv.Itoa(res.Copied + res.Linked)
+			if len(res.FoundIn) > 1 { // per input as well, e.g. "Found 10 (4 + 6)"
+				found += " (" + joinInts(res.FoundIn, " + ") + ")"
+				copied += " (" + joinInts(res.CopiedIn, " + ") + ")"
 			}
-			// copy file
-			var cpFrom string = filepath.Join(from, filename) // copy from
-			id++
-			var cpTo = filepath.Join(to, strconv.Itoa(id)+ext) // copy to
-			if optVerboseAll {                                 // TODO: replace by log level
-				fmt.Println("\"" + cpFrom + "\",\"" + cpTo + "\"")
+			var line string = fmt.Sprintf("Found %s, copied %s, %s", found, copied, formatRate(res.BytesCopied, time.Since(start)))
+			for _, f := range res.Copying { // large files on their own, e.g. "VID_1.mp4 42%"
+				line += fmt.Sprintf(", %s %d%%", filepath.Base(f.Source), f.Copied*100/f.Size)
 			}
-			var err = copy(cpFrom, cpTo) // copy
-			if err != nil {              // if we encounter an error in copy process
-				failed++ // record this incident
-				copyError++
-				if optVerboseErr || optVerboseAll { // TODO: replace by log level
-					fmt.Fprintln(os.Stderr, err.Error())
-				}
-			} else {
-				copied++ // record how many files were copied
+			if len(line) > width {
+				width = len(line)
 			}
+			fmt.Print("\r" + line + strings.Repeat(" ", width-len(line)))
 		}
 	}
 }
 
 /*
- * Copy a single file from one place to another
+ * Format the measured transfer rate of bytes copied in elapsed time, e.g. "12.3 MB/s"
+ * @return "0.0 MB/s" if no time has passed yet
  */
-func copy(from string, to string) error {
-	in, err := os.Open(from)
-
-	if err != nil {
-		return err
+func formatRate(bytes int64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "0.0 MB/s"
 	}
-	defer in.Close()
+	return fmt.Sprintf("%.1f MB/s", float64(bytes)/(1<<20)/elapsed.Seconds())
+}
 
-	out, err := os.Create(to)
-	if err != nil {
-		return err
+/*
+ * Join numbers with a separator, e.g. "4 + 6"
+ */
+func joinInts(numbers []int, sep string) string {
+	var parts []string
+	for _, n := range numbers {
+		parts = append(parts, strconv.Itoa(n))
 	}
-	defer out.Close()
+	return strings.Join(parts, sep)
+}
 
-	_, err = io.Copy(out, in)
+/*
+ * Parse a date given by -since or -until
+ * YYYY-MM-DD is local time, as the upper bound it covers the whole day
+ * @param end whether it's an upper bound
+ * @return zero value for an empty string
+ */
+func parseDate(date string, end bool) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", date, time.Local)
 	if err != nil {
-		return err
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
 	}
-	return out.Close()
+	return t, nil
 }
 
+/*
+ * Exit codes
+ * 0   success
+ * 1   failed to parse options
+ * 2   failed to parse extension string
+ * 3   invalid input directory
+ * 4   invalid output directory, manifest or error log file
+ * 5   some files or directories failed, or maximum depth was reached with -strict
+ * 6   not enough free space in output directory
+ * 7   no files found, unless -allow-empty
+ * 8   stopped by -timeout
+ * 9   output directory isn't empty, unless -append
+ * 130 interrupted by Ctrl+C
+ */
 func main() {
 	// initialize options
 	initOpts()
@@ -174,46 +407,841 @@ func main() {
 		fmt.Fprintln(os.Stderr, "failed to parse options")
 		os.Exit(1)
 	}
+	// fill in options not given on the command line from -config
+	if optConfig != "" {
+		if err := loadConfig(optConfig); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+	// -v and -vv are aliases of log levels
+	if optVerboseErr && optLogLevel < organizer.LOG_ERROR {
+		optLogLevel = organizer.LOG_ERROR
+	}
+	if optVerboseAll && optLogLevel < organizer.LOG_INFO {
+		optLogLevel = organizer.LOG_INFO
+	}
+	// -summary wins over -vv and -loglevel, lines per file are logged at LOG_INFO
+	if optSummary && optLogLevel > organizer.LOG_ERROR {
+		optLogLevel = organizer.LOG_ERROR
+	}
+	// structured logs carry source, destination and error as separate fields
+	var logger *slog.Logger
+	var logOpts = &slog.HandlerOptions{Level: slog.LevelDebug} // filtered by -loglevel already
+	switch optLogFormat {
+	case "plain":
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, logOpts))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, logOpts))
+	default:
+		fmt.Fprintln(os.Stderr, "invalid log format", strconv.Quote(optLogFormat)+", use plain, text or json")
+		os.Exit(1)
+	}
+	// undo a run instead of searching, other options than -m, -json, -q and logging don't apply
+	if optUndo != "" {
+		os.Exit(undo(optUndo, logger))
+	}
+	// verify the copies of a manifest instead of searching, other options than -json, -q and logging don't apply
+	if optCheck != "" {
+		os.Exit(check(optCheck, logger))
+	}
 	// parse extension string specified in -e
-	extArr = strings.Split(optExt, "|")
+	var extArr []string = strings.Split(optExt, "|")
 	if len(extArr) == 0 { // if we've got an empty string
 		fmt.Fprintln(os.Stderr, "failed to prase extension string")
 		os.Exit(2)
 	}
+	// expand -preset, it replaces the default of -e but is merged with an explicit -e
+	if optPreset != "" {
+		preset, ok := organizer.Presets[optPreset]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "unknown preset", strconv.Quote(optPreset)+", use common, raw, video or all")
+			os.Exit(2)
+		}
+		var extGiven bool = false
+		flag.Visit(func(f *flag.Flag) {
+			extGiven = extGiven || f.Name == "e"
+		})
+		if extGiven {
+			extArr = organizer.MergeExt(extArr, preset)
+		} else {
+			extArr = preset
+		}
+		optExt = strings.Join(extArr, "|") // shown in the summary
+	}
+	// -extfile works like -preset, with a list of its own
+	if optExtFile != "" {
+		exts, err := loadExtFile(optExtFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+		var extGiven bool = optPreset != ""
+		flag.Visit(func(f *flag.Flag) {
+			extGiven = extGiven || f.Name == "e"
+		})
+		if extGiven {
+			extArr = organizer.MergeExt(extArr, exts)
+		} else {
+			extArr = exts
+		}
+		optExt = strings.Join(extArr, "|")
+	}
+	// -video adds to whatever -e and -preset give
+	if optVideo {
+		extArr = organizer.MergeExt(extArr, organizer.Presets["video"])
+		optExt = strings.Join(extArr, "|")
+	}
+	// parse extensions to exclude given by -x, lowercase like the extensions of found files
+	var excludeArr []string
+	if optExclude != "" {
+		excludeArr = strings.Split(strings.ToLower(optExclude), "|")
+	}
+	// parse names given by -systemfiles, compared case-insensitively anyway
+	var systemArr []string
+	if optSystemFiles != "" {
+		systemArr = strings.Split(optSystemFiles, "|")
+	}
+	// parse size given by -minsize
+	minSize, errSize := organizer.ParseSize(optMinSize)
+	if errSize != nil {
+		fmt.Fprintln(os.Stderr, errSize.Error())
+		os.Exit(1)
+	}
+	// parse size given by -bufsize
+	bufSize, errBuf := organizer.ParseSize(optBufSize)
+	if errBuf != nil || bufSize < 1 {
+		fmt.Fprintln(os.Stderr, "invalid buffer size", strconv.Quote(optBufSize))
+		os.Exit(1)
+	}
+	// compile regular expressions given by -match and -nomatch
+	var match, noMatch *regexp.Regexp
+	for _, re := range []struct {
+		name     string
+		pattern  string
+		compiled **regexp.Regexp
+	}{{"-match", optMatch, &match}, {"-nomatch", optNoMatch, &noMatch}} {
+		if re.pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(re.pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid", re.name, "pattern:", err.Error())
+			os.Exit(1)
+		}
+		*re.compiled = compiled
+	}
+	// parse dates given by -since and -until
+	since, errSince := parseDate(optSince, false)
+	until, errUntil := parseDate(optUntil, true)
+	if errSince != nil || errUntil != nil {
+		fmt.Fprintln(os.Stderr, "invalid date, use YYYY-MM-DD or RFC3339, e.g. 2019-01-02T15:04:05Z")
+		os.Exit(1)
+	}
+	// parse bandwidth given by -ratelimit, "/s" is optional
+	var rateLimit int64
+	if optRateLimit != "" {
+		var errRate error
+		rateLimit, errRate = organizer.ParseSize(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(optRateLimit)), "/s"))
+		if errRate != nil || rateLimit < 1 {
+			fmt.Fprintln(os.Stderr, "invalid rate limit", strconv.Quote(optRateLimit)+", use e.g. 10MB/s")
+			os.Exit(1)
+		}
+	}
+	// parse thumbnail size given by -thumb
+	var thumbWidth, thumbHeight int
+	if optThumb != "" {
+		var ok bool
+		thumbWidth, thumbHeight, ok = parseDim(optThumb)
+		if !ok || thumbWidth < 1 || thumbHeight < 1 {
+			fmt.Fprintln(os.Stderr, "invalid thumbnail size", strconv.Quote(optThumb)+", use WxH, e.g. 320x240")
+			os.Exit(1)
+		}
+	}
+	// parse minimum dimensions given by -mindim, 0 for either side means no limit
+	var minWidth, minHeight int
+	if optMinDim != "" {
+		var ok bool
+		minWidth, minHeight, ok = parseDim(optMinDim)
+		if !ok || minWidth < 0 || minHeight < 0 {
+			fmt.Fprintln(os.Stderr, "invalid minimum dimensions", strconv.Quote(optMinDim)+", use WxH, e.g. 1920x1080 or 1920x0")
+			os.Exit(1)
+		}
+	}
+	if optSample < 0 {
+		fmt.Fprintln(os.Stderr, "invalid sample size", strconv.Itoa(optSample)+", use 0 for all files")
+		os.Exit(1)
+	}
+	if optNoRecurse && optMinDepth > 0 {
+		fmt.Fprintln(os.Stderr, "-norecurse only takes files right under the input directory, -mindepth would skip all of them")
+		os.Exit(1)
+	}
+	if optStructure != "" && (optByDate || optByExt) {
+		fmt.Fprintln(os.Stderr, "-structure replaces -bydate and -byext, use {year}/{month} and {ext} in it instead")
+		os.Exit(1)
+	}
+	if optMinFree < 0 || optMinFree > 99 {
+		fmt.Fprintln(os.Stderr, "invalid minimum free space", strconv.Itoa(optMinFree)+"%, use 0 to 99")
+		os.Exit(1)
+	}
+	if optQuality < 1 || optQuality > 100 {
+		fmt.Fprintln(os.Stderr, "invalid JPEG quality", strconv.Itoa(optQuality)+", use 1 to 100")
+		os.Exit(1)
+	}
+	// move makes no sense without copy
+	if optMove && (optScanOnly || optPlan || optStats || optHistogram) {
+		fmt.Fprintln(os.Stderr, "-m is ignored in scan-only mode (-s, -plan, -stats, -histogram)")
+		optMove = false
+	}
+	// the original would be gone with only a smaller or re-encoded image left
+	if optMove && (optThumb != "" || optAutoRotate || optConvert != "") {
+		fmt.Fprintln(os.Stderr, "-m can't be used with -thumb, -autorotate or -convert, the originals would be deleted without an identical copy")
+		os.Exit(1)
+	}
+	if optPrune && !optMove {
+		fmt.Fprintln(os.Stderr, "-prune is ignored without -m")
+	}
+	if optKeepEmpty && !optTree {
+		fmt.Fprintln(os.Stderr, "-keepempty is ignored without -tree, flattened copies have no directories to keep")
+	}
+	if optNewest && !optKeep && !optTree && optTemplate == "" {
+		fmt.Fprintln(os.Stderr, "-newest is ignored without -keep, -tree or -template, sequential names never collide")
+	}
 	// convert pathes given by -i and -o to absolute pathes
-	absIn, errIn := filepath.Abs(optIn)
-	if errIn != nil {
-		fmt.Fprintln(os.Stderr, errIn.Error())
-		os.Exit(3)
+	var absIns []string // absolute input directories
+	for _, in := range strings.Split(optIn, ",") {
+		absIn, errIn := filepath.Abs(in)
+		if errIn != nil {
+			fmt.Fprintln(os.Stderr, errIn.Error())
+			os.Exit(3)
+		}
+		absIns = append(absIns, absIn)
 	}
 	absOut, errOut := filepath.Abs(optOut)
 	if errOut != nil {
 		fmt.Fprintln(os.Stderr, errOut.Error())
 		os.Exit(4)
 	}
-	// create output directory if not exists
-	os.Mkdir(absOut, os.ModePerm)
-	// process directory
-	processDir(absIn, absOut, 0)
+	// stdout is the script with -print-commands, logs go to stderr and the summary is left out
+	if optCommands && optJSON {
+		fmt.Fprintln(os.Stderr, "-print-commands and -json both write to stdout, use one of them")
+		os.Exit(1)
+	}
+	// create output directory if not exists, before the manifest which may live in it
+	if !optCommands {
+		os.Mkdir(absOut, os.ModePerm)
+	}
+	// don't mix a new import into an old one by accident, e.g. in the default image-organizer
+	if !optAppend && !optScanOnly && !optPlan && !optStats && !optHistogram && !optCommands && !isEmptyDir(absOut, systemArr) {
+		fmt.Fprintln(os.Stderr, "output directory", absOut, "isn't empty, use -append to add to it")
+		os.Exit(9)
+	}
+	var cfg = organizer.Config{
+		In:          absIns,
+		Out:         absOut,
+		Ext:         extArr,
+		Exclude:     excludeArr,
+		SystemFiles: systemArr,
+		Hidden:      optHidden,
+		Depth:       optDepth,
+		MinDepth:    optMinDepth,
+		NoRecurse:   optNoRecurse,
+		Sort:        optSort,
+		Follow:      optFollow,
+		ScanOnly:    optScanOnly,
+		Stats:       optStats,
+		Plan:        optPlan,
+		Histogram:   optHistogram,
+		Move:        optMove,
+		Prune:       optPrune,
+		KeepEmpty:   optKeepEmpty,
+		Keep:        optKeep,
+		Force:       optForce,
+		Dedup:       optDedup,
+		HashName:    optHashName,
+		Newest:      optNewest,
+		NoTime:      optNoTime,
+		NoPerm:      optNoPerm,
+		Retries:     optRetries,
+		Jobs:        optJobs,
+		ScanJobs:    optScanJobs,
+		RateLimit:   rateLimit,
+		BufSize:     int(bufSize),
+		Prefix:      optPrefix,
+		Parents:     optParents,
+		Name:        optName,
+		MinSize:     minSize,
+		MinWidth:    minWidth,
+		MinHeight:   minHeight,
+		KeepNoDim:   optKeepNoDim,
+		AllowEmpty:  optAllowEmptyFiles,
+		Match:       match,
+		NoMatch:     noMatch,
+		Since:       since,
+		Until:       until,
+		Sniff:       optSniff,
+		ByDate:      optByDate,
+		Tree:        optTree,
+		FlatDepth:   optFlatDepth,
+		ByExt:       optByExt,
+		Structure:   optStructure,
+		NormExt:     optNormExt,
+		IDPerExt:    optIDPerExt,
+		Pad:         optPad,
+		Template:    optTemplate,
+		ThumbWidth:  thumbWidth,
+		ThumbHeight: thumbHeight,
+		AutoRotate:  optAutoRotate,
+		Quality:     optQuality,
+		Collision:   optCollision,
+		Convert:     strings.TrimPrefix(strings.ToLower(optConvert), "."),
+		Link:        optLink,
+		Verify:      optVerify,
+		Xattrs:      optXattrs,
+		Sidecars:    optSidecars,
+		Gallery:     optGallery,
+		MaxFiles:    optMaxFiles,
+		Sample:      optSample,
+		Seed:        optSeed,
+		NoCheck:     optNoCheck,
+		MinFree:     optMinFree,
+		IgnoreFile:  optIgnoreFile,
+		State:       optState,
+		LogLevel:    optLogLevel,
+		Logger:      logger,
+	}
+	if optJSON || optCommands { // keep stdout clean for the summary or the commands
+		cfg.Stdout = os.Stderr
+	}
+	if optCommands {
+		cfg.Commands = os.Stdout
+	}
+	// open manifest
+	var manifestFile *os.File
+	if optManifest != "" {
+		var err error
+		manifestFile, err = os.Create(optManifest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(4)
+		}
+		cfg.Manifest = manifestFile
+	}
+	// open error log, closed before any exit below
+	errLogFile, err := openErrLog()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(4)
+	}
+	if errLogFile != nil {
+		cfg.ErrLog = errLogFile
+	}
+	// stop cleanly on Ctrl+C, a second Ctrl+C kills the process as usual
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var interrupt = make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		cancel()
+	}()
+	// a hung network mount must not block an unattended run forever
+	if optTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, optTimeout)
+		defer cancelTimeout()
+	}
+	// ask on stderr, so stdout stays clean for -json
+	if optConfirm && !optYes {
+		cfg.Confirm = func(found organizer.Result) bool {
+			var verb string = "Copy"
+			if optLink {
+				verb = "Link"
+			} else if optMove {
+				verb = "Move"
+			}
+			fmt.Fprintf(os.Stderr, "%s %d files (%s)? [y/N] ", verb, found.Found, organizer.FormatSize(found.BytesFound))
+			var answer = make(chan string, 1)
+			go func() {
+				line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				answer <- line
+			}()
+			select {
+			case <-ctx.Done(): // Ctrl+C at the prompt
+				fmt.Fprintln(os.Stderr)
+				return false
+			case line := <-answer:
+				line = strings.ToLower(strings.TrimSpace(line))
+				return line == "y" || line == "yes"
+			}
+		}
+	}
+	// show progress on terminals only, so piped output stays clean
+	var stopProgress = make(chan struct{})
+	var progressDone = make(chan struct{})
+	if !optNoProgress && !optQuiet && !optJSON && !optCommands && isTerminal(os.Stdout) {
+		var mu sync.Mutex
+		var current organizer.Result // latest counters reported by Organize
+		cfg.Progress = func(res organizer.Result) {
+			mu.Lock()
+			current = res
+			mu.Unlock()
+		}
+		go progress(func() organizer.Result {
+			mu.Lock()
+			defer mu.Unlock()
+			return current
+		}, stopProgress, progressDone)
+	} else {
+		close(progressDone)
+	}
+	// search and copy
+	var start time.Time = time.Now()
+	res, err := organizer.Organize(ctx, cfg)
+	var elapsed time.Duration = time.Since(start)
+	close(stopProgress)
+	<-progressDone
+	if manifestFile != nil {
+		if err := manifestFile.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+	if errLogFile != nil {
+		if err := errLogFile.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+	var canceled bool = errors.Is(err, organizer.ErrCanceled)
+	var timedOut bool = canceled && errors.Is(err, context.DeadlineExceeded)
+	if errors.Is(err, organizer.ErrNoSpace) {
+		fmt.Fprintln(os.Stderr, err.Error()+", use -nocheck to copy anyway")
+		os.Exit(6)
+	}
+	if errors.Is(err, organizer.ErrDeclined) {
+		fmt.Fprintln(os.Stderr, "nothing copied")
+		os.Exit(0)
+	}
+	if err != nil && !canceled { // the run didn't start, e.g. invalid ignore file
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
 	// show result
+	if optJSON {
+		data, err := json.Marshal(res)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else if (!optQuiet || optSummary) && !optCommands {
+		printSummary(res, absIns, absOut, canceled, timedOut, elapsed)
+	}
+	if timedOut {
+		os.Exit(8)
+	}
+	if canceled {
+		os.Exit(130) // 128 + SIGINT, as shells do
+	}
+	if res.LowSpace {
+		os.Exit(6)
+	}
+	if res.Failed != 0 || (optStrict && res.DepthLimitReached != 0) {
+		os.Exit(5)
+	}
+	// -stats counts every file per extension instead of in Found
+	if !optAllowEmpty && res.Found == 0 && len(res.ExtStats) == 0 {
+		fmt.Fprintln(os.Stderr, "no files found, use -allow-empty to exit with 0 anyway")
+		os.Exit(7)
+	}
+	os.Exit(0)
+}
+
+/*
+ * Print the summary of a run
+ * @param ins      absolute input directories
+ * @param out      absolute output directory
+ * @param canceled whether the run was interrupted
+ * @param timedOut whether it was interrupted by -timeout
+ * @param elapsed  duration of the run, for the transfer rate
+ */
+func printSummary(res organizer.Result, ins []string, out string, canceled bool, timedOut bool, elapsed time.Duration) {
 	fmt.Println("")
 	fmt.Printf("Image Organizer v%d.%d.%d    ", VER_MAJ, VER_MIN, VER_REV)
 	fmt.Println("")
 	fmt.Println("")
-	fmt.Println("Found", found, "files with extension", optExt, "under directory")
-	fmt.Println(absIn)
-	if copied != 0 {
-		fmt.Println("Copied", copied, "files to directory")
-		fmt.Println(absOut)
+	var found string = "files" // what has been searched for
+	if optVideo {
+		found = "images and videos"
+	}
+	if optStats {
+		printStats(res.ExtStats, ins)
+	} else if len(ins) == 1 {
+		fmt.Println("Found", res.Found, found, "with extension", optExt, "under directory")
+		fmt.Println(ins[0])
+	} else {
+		fmt.Println("Found", res.Found, found, "with extension", optExt, "under", len(ins), "directories")
+		// counts per input, so one that contributed nothing stands out, e.g. a typo or a drive that isn't mounted
+		fmt.Printf("%8s %8s %8s  %s\n", "found", "copied", "failed", "directory")
+		for i, in := range ins {
+			var note string
+			if res.FoundIn[i] == 0 && !canceled && !res.MaxReached && !res.LowSpace { // a stopped run may not have got there
+				note = "  (nothing found)"
+			}
+			fmt.Printf("%8d %8d %8d  %s%s\n", res.FoundIn[i], res.CopiedIn[i], res.FailedIn[i], in, note)
+		}
+		fmt.Printf("%8d %8d %8d  %s\n", res.Found, res.Copied+res.Linked, res.Failed, "total")
+	}
+	if optHistogram {
+		printHistogram(res.Days)
+	}
+	if optScanOnly || optPlan || optHistogram {
+		fmt.Println("Found files take", organizer.FormatSize(res.BytesFound))
+	}
+	if optPlan {
+		fmt.Println("Would copy", res.New, "new files,", res.Present, "are already present in directory")
+		fmt.Println(out)
+	}
+	if res.Copied != 0 {
+		fmt.Println("Copied", res.Copied, "files ("+organizer.FormatSize(res.BytesCopied)+" at "+formatRate(res.BytesCopied, elapsed)+") to directory")
+		fmt.Println(out)
+	}
+	if res.Retried != 0 {
+		fmt.Println("Copied", res.Retried, "files only after a retry")
+	}
+	if res.Thumbs != 0 {
+		fmt.Println("Wrote", res.Thumbs, "of them as thumbnails")
+	}
+	if res.Rotated != 0 {
+		fmt.Println("Turned", res.Rotated, "of them upright")
+	}
+	if res.Converted != 0 {
+		fmt.Println("Converted", res.Converted, "of them to", optConvert)
+	}
+	if res.NoConvert != 0 {
+		fmt.Println("Copied", res.NoConvert, "files as they are that couldn't be converted, use -v to list them")
+	}
+	if optByExt && len(res.CopiedByExt) != 0 {
+		var exts []string
+		for ext := range res.CopiedByExt {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		for _, ext := range exts {
+			fmt.Println(res.CopiedByExt[ext], ext)
+		}
+	}
+	if res.Corrected != 0 {
+		fmt.Println("Corrected the extension of", res.Corrected, "files whose content is of another type, use -v to list them")
+	}
+	if res.Resumed != 0 {
+		fmt.Println("Skipped", res.Resumed, "files copied by an earlier run according to", optState)
+	}
+	if res.Hidden != 0 {
+		fmt.Println("Skipped", res.Hidden, "hidden files and directories, use -hidden to take them")
+	}
+	if res.SystemFiles != 0 {
+		fmt.Println("Skipped", res.SystemFiles, "system files and directories, e.g. .DS_Store or Thumbs.db")
+	}
+	if res.Ignored != 0 {
+		fmt.Println("Ignored", res.Ignored, "files and directories matching ignore patterns")
+	}
+	if res.EmptyFiles != 0 {
+		fmt.Println("Skipped", res.EmptyFiles, "empty files, use -allow-empty-files to take them")
+	}
+	if res.TooSmall != 0 {
+		fmt.Println("Skipped", res.TooSmall, "files smaller than", optMinSize)
+	}
+	if res.TooSmallDim != 0 {
+		fmt.Println("Skipped", res.TooSmallDim, "images smaller than", optMinDim, "pixels")
+	}
+	if res.NoDim != 0 {
+		if optKeepNoDim {
+			fmt.Println("Took", res.NoDim, "files whose dimensions couldn't be read")
+		} else {
+			fmt.Println("Skipped", res.NoDim, "files whose dimensions couldn't be read, use -mindim-keep to take them")
+		}
+	}
+	if res.OutOfRange != 0 {
+		fmt.Println("Skipped", res.OutOfRange, "files modified outside of -since and -until")
+	}
+	if res.NameFiltered != 0 {
+		fmt.Println("Skipped", res.NameFiltered, "files filtered out by -match or -nomatch")
+	}
+	if res.Linked != 0 {
+		fmt.Println("Linked", res.Linked, "files to directory")
+		fmt.Println(out)
+	}
+	if res.Skipped != 0 {
+		fmt.Println("Skipped", res.Skipped, "files because destination already exists, use -f to overwrite")
+	}
+	if res.Duplicates != 0 {
+		fmt.Println("Skipped", res.Duplicates, "duplicate files with identical content")
+	}
+	if res.Outdated != 0 {
+		fmt.Println("Skipped", res.Outdated, "files with a newer one of the same name, replaced", res.Replaced, "older ones")
+	} else if res.Replaced != 0 {
+		fmt.Println("Replaced", res.Replaced, "older copies with a newer file of the same name")
+	}
+	if res.Moved != 0 {
+		fmt.Println("Moved", res.Moved, "files, source files were removed")
+	}
+	if res.Pruned != 0 {
+		fmt.Println("Removed", res.Pruned, "source directories left empty")
+	}
+	if res.Sidecars != 0 {
+		fmt.Println("Copied", res.Sidecars, "sidecar files along with their images")
+	}
+	if res.Gallery != "" {
+		fmt.Println("Wrote a gallery of the copies to")
+		fmt.Println(res.Gallery)
+	}
+	if res.Failed != 0 {
+		fmt.Println("Encountered", res.Failed, "failures, including", res.CopyError, "copy failures and", res.DirError, "directory failures")
+	}
+	if res.PermDenied != 0 {
+		fmt.Println("Skipped", res.PermDenied, "directories without read permission, run as their owner or fix their permissions")
+	}
+	if res.VerifyError != 0 {
+		fmt.Println("Removed", res.VerifyError, "copies that differ from their source")
+	}
+	if res.RemoveError != 0 {
+		fmt.Println("Failed to remove", res.RemoveError, "source files after copy")
+	}
+	if res.Panics != 0 {
+		fmt.Println("Gave up on", res.Panics, "files that crashed while processing, likely malformed images")
+	}
+	if res.XattrError != 0 {
+		fmt.Println("Failed to copy extended attributes of", res.XattrError, "files")
+	}
+	if optPad > 0 && len(strconv.Itoa(res.LastID)) > optPad {
+		fmt.Println("IDs grew beyond", optPad, "digits, raise -pad for names to sort correctly")
+	}
+	if res.Irregular != 0 {
+		fmt.Println("Skipped", res.Irregular, "named pipes, sockets or devices, they can't be copied like files")
+	}
+	if res.SymlinkSkipped != 0 {
+		fmt.Println("Skipped", res.SymlinkSkipped, "symlinked directories, use -L to follow them")
+	}
+	if res.SymlinkLoops != 0 {
+		fmt.Println("Skipped", res.SymlinkLoops, "directories visited before through symlinks")
+	}
+	if res.DepthLimitReached != 0 {
+		fmt.Println("Stopped at maximum depth", optDepth, "for", res.DepthLimitReached, "times, use -d 0 for no limit")
+	}
+	if optSample > 0 {
+		fmt.Println("Picked", res.Sampled, "of them at random, -seed", res.Seed, "picks the same files again")
+	}
+	if res.MaxReached {
+		fmt.Println("Stopped after", res.Taken, "files, limit of -maxfiles reached")
 	}
-	if failed != 0 {
-		fmt.Println("Encountered", failed, "failures, including", copyError, "copy failures and", dirError, "directory failures")
+	if res.LowSpace {
+		fmt.Println("Stopped for low disk space, less than", strconv.Itoa(optMinFree)+"% would have been free,", res.Remaining, "files remain")
 	}
-	if depthLimitReached != 0 {
-		fmt.Println("Stopped at maximum depth", optDepth, "for", depthLimitReached, "times ")
+	if timedOut {
+		fmt.Println("Timed out after " + optTimeout.String() + ", the numbers above cover what was done until then")
+	} else if canceled {
+		fmt.Println("Interrupted, the numbers above cover what was done until then")
 	}
 	fmt.Println("")
 	fmt.Println("\"imo -h\" for help")
 	fmt.Println("")
-	os.Exit(0)
+}
+
+/*
+ * Open the file given by -errlog for appending
+ * @return nil without -errlog
+ */
+func openErrLog() (*os.File, error) {
+	if optErrLog == "" {
+		return nil, nil
+	}
+	return os.OpenFile(optErrLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+/*
+ * Undo the run that wrote a manifest given by -undo
+ * @return exit code, 4 if the manifest can't be read, 5 if copies failed or have changed
+ */
+func undo(path string, logger *slog.Logger) int {
+	in, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 4
+	}
+	defer in.Close()
+	// stop cleanly on Ctrl+C like a run does
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	var cfg = organizer.Config{Move: optMove, LogLevel: optLogLevel, Logger: logger}
+	errLogFile, err := openErrLog()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 4
+	}
+	if errLogFile != nil {
+		defer errLogFile.Close()
+		cfg.ErrLog = errLogFile
+	}
+	if optJSON { // keep stdout clean for the summary
+		cfg.Stdout = os.Stderr
+	}
+	res, err := organizer.Undo(ctx, in, cfg)
+	var canceled bool = errors.Is(err, organizer.ErrCanceled)
+	if err != nil && !canceled {
+		fmt.Fprintln(os.Stderr, path+":", err.Error())
+		return 4
+	}
+	if optJSON {
+		data, err := json.Marshal(res)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		fmt.Println(string(data))
+	} else if !optQuiet || optSummary {
+		fmt.Println("")
+		fmt.Printf("Image Organizer v%d.%d.%d    ", VER_MAJ, VER_MIN, VER_REV)
+		fmt.Println("")
+		fmt.Println("")
+		fmt.Println("Removed", res.Removed, "copies recorded in")
+		fmt.Println(path)
+		if res.Restored != 0 {
+			fmt.Println("Moved", res.Restored, "copies back to their source")
+		}
+		if res.Changed != 0 {
+			fmt.Println("Kept", res.Changed, "copies that have changed since, use -v to list them")
+		}
+		if res.Missing != 0 {
+			fmt.Println("Skipped", res.Missing, "copies that don't exist anymore")
+		}
+		if res.Failed != 0 {
+			fmt.Println("Failed to remove", res.Failed, "copies")
+		}
+		if canceled {
+			fmt.Println("Interrupted, the remaining copies are left in place")
+		}
+		fmt.Println("")
+	}
+	if canceled {
+		return 130
+	}
+	if res.Failed != 0 || res.Changed != 0 {
+		return 5
+	}
+	return 0
+}
+
+/*
+ * Verify the copies recorded in a manifest given by -check
+ * @return exit code, 4 for a manifest or error log that can't be read or written,
+ *         5 if any copy is missing, differs or can't be read
+ */
+func check(path string, logger *slog.Logger) int {
+	in, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 4
+	}
+	defer in.Close()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	var cfg = organizer.Config{LogLevel: optLogLevel, Logger: logger}
+	errLogFile, err := openErrLog()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 4
+	}
+	if errLogFile != nil {
+		defer errLogFile.Close()
+		cfg.ErrLog = errLogFile
+	}
+	if optJSON { // keep stdout clean for the summary
+		cfg.Stdout = os.Stderr
+	}
+	res, err := organizer.Check(ctx, in, cfg)
+	var canceled bool = errors.Is(err, organizer.ErrCanceled)
+	if err != nil && !canceled {
+		fmt.Fprintln(os.Stderr, path+":", err.Error())
+		return 4
+	}
+	if optJSON {
+		data, err := json.Marshal(res)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		fmt.Println(string(data))
+	} else if !optQuiet || optSummary {
+		fmt.Println("")
+		fmt.Printf("Image Organizer v%d.%d.%d    ", VER_MAJ, VER_MIN, VER_REV)
+		fmt.Println("")
+		fmt.Println("")
+		fmt.Println("Verified", res.OK, "copies recorded in")
+		fmt.Println(path)
+		if res.Mismatch != 0 {
+			fmt.Println("Found", res.Mismatch, "copies that differ from the manifest, use -v to list them")
+		}
+		if res.Missing != 0 {
+			fmt.Println("Found", res.Missing, "copies missing, use -v to list them")
+		}
+		if res.Failed != 0 {
+			fmt.Println("Failed to read", res.Failed, "copies")
+		}
+		if canceled {
+			fmt.Println("Interrupted, the remaining copies haven't been checked")
+		}
+		fmt.Println("")
+	}
+	if canceled {
+		return 130
+	}
+	if res.Mismatch != 0 || res.Missing != 0 || res.Failed != 0 {
+		return 5
+	}
+	return 0
+}
+
+/*
+ * Print files per day found by -histogram as a bar chart, oldest first
+ * bars are scaled to the busiest day, days without files are left out
+ */
+func printHistogram(days map[string]int) {
+	const width = 50 // characters of the longest bar
+	var dates []string
+	var most int
+	for date, count := range days {
+		dates = append(dates, date)
+		most = max(most, count)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		var bar int = max(1, days[date]*width/most) // every day with files gets a mark
+		fmt.Printf("%s %6d %s\n", date, days[date], strings.Repeat("#", bar))
+	}
+}
+
+/*
+ * Print files and size per extension found by -stats, most frequent first
+ */
+func printStats(stats map[string]organizer.ExtStat, ins []string) {
+	var exts []string
+	for ext := range stats {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(a, b int) bool {
+		if stats[exts[a]].Count != stats[exts[b]].Count {
+			return stats[exts[a]].Count > stats[exts[b]].Count
+		}
+		return exts[a] < exts[b]
+	})
+	fmt.Println("Found", len(exts), "extensions under", strings.Join(ins, ", "))
+	for _, ext := range exts {
+		var name string = ext
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Printf("%-10s %8d files %10s\n", name, stats[ext].Count, organizer.FormatSize(stats[ext].Size))
+	}
 }
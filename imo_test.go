@@ -0,0 +1,78 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of the command line helpers
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/real-benjamin-lee/image-organizer/organizer"
+)
+
+func TestFormatRate(t *testing.T) {
+	var tests = []struct {
+		bytes   int64
+		elapsed time.Duration
+		want    string
+	}{
+		{0, time.Second, "0.0 MB/s"},
+		{10 << 20, time.Second, "10.0 MB/s"},
+		{10 << 20, 4 * time.Second, "2.5 MB/s"},
+		{1 << 19, time.Second, "0.5 MB/s"},
+		{3 << 20, 1500 * time.Millisecond, "2.0 MB/s"},
+		{1 << 20, 0, "0.0 MB/s"}, // first tick
+	}
+	for _, tt := range tests {
+		if got := formatRate(tt.bytes, tt.elapsed); got != tt.want {
+			t.Errorf("formatRate(%d, %s) = %s, want %s", tt.bytes, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestIsEmptyDir(t *testing.T) {
+	var tests = []struct {
+		name   string
+		files  []string
+		system []string
+		want   bool
+	}{
+		{"empty", nil, nil, true},
+		{"default system files", []string{".DS_Store", "THUMBS.DB"}, nil, true},
+		{"an image", []string{".DS_Store", "a.jpg"}, nil, false},
+		{"further system files", []string{"Thumbs.db", ".picasa.ini", "@eaDir"}, []string{".picasa.ini", "@EADIR"}, true},
+		{"not among further ones", []string{".picasa.ini", "b.jpg"}, []string{".picasa.ini"}, false},
+	}
+	for _, tt := range tests {
+		var dir string = t.TempDir()
+		for _, name := range tt.files {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := isEmptyDir(dir, tt.system); got != tt.want {
+			t.Errorf("%s: isEmptyDir = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !isEmptyDir(filepath.Join(t.TempDir(), "missing"), nil) {
+		t.Error("missing directory isn't empty")
+	}
+	// the defaults are left as they are, even with room to grow
+	var defaults []string = organizer.DefaultSystemFiles
+	organizer.DefaultSystemFiles = append(make([]string, 0, len(defaults)+4), defaults...)
+	defer func() { organizer.DefaultSystemFiles = defaults }()
+	var dir string = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	isEmptyDir(dir, []string{".picasa.ini"})
+	if !reflect.DeepEqual(organizer.DefaultSystemFiles, defaults) || organizer.DefaultSystemFiles[:len(defaults)+1][len(defaults)] != "" {
+		t.Error("-systemfiles names written into DefaultSystemFiles")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Verify the copies recorded in a manifest, e.g. to detect bit rot in an archive
+ */
+
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// result of Check
+type CheckResult struct {
+	OK       int `json:"ok"`       // copies whose size and SHA-256 match the manifest
+	Mismatch int `json:"mismatch"` // copies whose content differs from the manifest
+	Missing  int `json:"missing"`  // copies that don't exist anymore
+	Failed   int `json:"failed"`   // copies that couldn't be read
+}
+
+/*
+ * Check every copy recorded in a manifest against its size and SHA-256, see Config.Manifest
+ * nothing is changed, rows without destination, written in scan-only mode, are skipped
+ * note: only Stdout, Stderr, LogLevel, Logger and ErrLog of cfg are used
+ * @return an error if the manifest can't be read, or ErrCanceled if ctx was done
+ */
+func Check(ctx context.Context, manifest io.Reader, cfg Config) (CheckResult, error) {
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Stderr == nil {
+		cfg.Stderr = os.Stderr
+	}
+	var res CheckResult
+	r, err := readManifest(manifest)
+	if err != nil {
+		return res, err
+	}
+	for {
+		if ctx.Err() != nil {
+			return res, fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+		}
+		record, err := r.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		var to, hash string = record[1], record[3]
+		if to == "" { // found in scan-only mode, nothing was copied
+			continue
+		}
+		size, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return res, fmt.Errorf("invalid size %q of %s in manifest", record[2], to)
+		}
+		info, err := os.Stat(to)
+		if os.IsNotExist(err) {
+			res.Missing++ // record this incident
+			logf(cfg, LOG_ERROR, "missing %s", slog.String("destination", to))
+			continue
+		}
+		if err == nil && info.Size() != size { // no need to read it
+			res.Mismatch++ // record this incident
+			logf(cfg, LOG_ERROR, "%s differs from manifest, %d bytes instead of %d", slog.String("destination", to), slog.Int64("size", info.Size()), slog.Int64("expected", size))
+			continue
+		}
+		var current string
+		if err == nil {
+			current, err = hashFile(to)
+		}
+		if err != nil {
+			res.Failed++ // record this incident
+			logf(cfg, LOG_ERROR, "%s", slog.Any("error", err), slog.String("destination", to))
+			continue
+		}
+		if current != hash {
+			res.Mismatch++ // record this incident
+			logf(cfg, LOG_ERROR, "%s differs from manifest, SHA-256 %s instead of %s", slog.String("destination", to), slog.String("sha256", current), slog.String("expected", hash))
+			continue
+		}
+		res.OK++ // record this incident
+		logf(cfg, LOG_INFO, "ok %s", slog.String("destination", to))
+	}
+}
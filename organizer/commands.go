@@ -0,0 +1,73 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Print shell commands doing what a run would do, instead of copying
+ */
+
+package organizer
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * Quote a path for a POSIX shell, in single quotes unless it's made of safe characters only
+ * e.g. it's -> 'it'\''s'
+ */
+func shellQuote(s string) string {
+	var safe bool = s != ""
+	for _, c := range s {
+		safe = safe && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-+=.,/:@%", c))
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+/*
+ * Print the commands of a job to Config.Commands, its sidecars included
+ * cp keeps the modification time unless NoTime, mv with Move, ln with Link falls back to cp like a run does,
+ * the destination directory is created by mkdir -p before its first file
+ */
+func (o *organizer) printCommands(j job) {
+	var copies = [][2]string{{j.from, j.to}}
+	if o.cfg.Sidecars {
+		for _, s := range findSidecars(j.from) {
+			copies = append(copies, [2]string{s.path, sidecarDest(j, s)})
+		}
+	}
+	var cp string = "cp --"
+	if !o.cfg.NoTime {
+		cp = "cp -p --"
+	}
+	var lines strings.Builder
+	o.mu.Lock()
+	var dir string = filepath.Dir(j.to)
+	if !o.madeDirs[dir] {
+		o.madeDirs[dir] = true
+		lines.WriteString("mkdir -p -- " + shellQuote(dir) + "\n")
+	}
+	for _, c := range copies {
+		var from, to string = shellQuote(c[0]), shellQuote(c[1])
+		switch {
+		case o.cfg.Move:
+			lines.WriteString("mv -- " + from + " " + to + "\n")
+		case o.cfg.Link:
+			lines.WriteString("ln -- " + from + " " + to + " 2>/dev/null || " + cp + " " + from + " " + to + "\n")
+		default:
+			lines.WriteString(cp + " " + from + " " + to + "\n")
+		}
+	}
+	_, err := io.WriteString(o.cfg.Commands, lines.String())
+	if err == nil {
+		o.res.Commands++ // record how many files were printed
+	}
+	o.mu.Unlock()
+	if err != nil {
+		o.fail(j.in, err, slog.String("source", j.from), slog.String("destination", j.to))
+	}
+}
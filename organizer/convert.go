@@ -0,0 +1,68 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Convert images to a single format
+ */
+
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"time"
+)
+
+// returned, wrapped, by convertFile if the source can't be decoded, it's copied as it is then
+var errNoConvert = errors.New("can't decode image to convert it")
+
+// formats Convert writes, by extension, to the name image.Decode reports for them
+var convertFormats = map[string]string{"jpg": "jpeg", "png": "png"}
+
+/*
+ * Write an image re-encoded in another format
+ * decoders are registered for JPEG, PNG, GIF and uncompressed BMP (dim.go), HEIC isn't supported,
+ * EXIF data isn't carried over, so the orientation is applied to the pixels instead
+ * transparent areas become white in a JPEG
+ * @param ext         extension of the format to write, a key of convertFormats
+ * @param quality     JPEG quality, 1 to 100
+ * @param orientation EXIF orientation of the source, applied if > 1
+ * @param modTime     set as access and modification time of the copy, zero value leaves it untouched
+ * @param mode        permission bits of the copy, 0 for 0644
+ * @param h           if not nil, content is written to h as well
+ * @return size of the copy
+ */
+func convertFile(ctx context.Context, from string, to string, ext string, quality int, orientation int, modTime time.Time, mode os.FileMode, h hash.Hash) (int64, error) {
+	in, err := os.Open(longPath(from))
+	if err != nil {
+		return 0, err
+	}
+	src, _, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return 0, fmt.Errorf("%w %s: %s", errNoConvert, from, err)
+	}
+	if ctx.Err() != nil { // decoding a large image takes a while
+		return 0, ErrCanceled
+	}
+	if orientation > 1 {
+		src = orient(src, orientation)
+	}
+	return writeAtomic(to, modTime, mode, h, func(w io.Writer) error {
+		if ext == "png" {
+			return png.Encode(w, src)
+		}
+		var b image.Rectangle = src.Bounds()
+		var dst = image.NewRGBA(b)
+		draw.Draw(dst, b, image.White, image.Point{}, draw.Src)
+		draw.Draw(dst, b, src, b.Min, draw.Over)
+		return jpeg.Encode(w, dst, &jpeg.Options{Quality: quality})
+	})
+}
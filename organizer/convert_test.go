@@ -0,0 +1,146 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of re-encoding copies with Convert
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+/*
+ * Encode a small PNG image
+ */
+func pngData(t *testing.T) []byte {
+	t.Helper()
+	var img = image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConvertNoConvert(t *testing.T) {
+	// files that can't be converted are counted by processDir if their header can't be read,
+	// by the workers if only their image data is broken, run with -race to check both at once
+	var in, out string = t.TempDir(), t.TempDir()
+	var data []byte = pngData(t)
+	for i := 0; i < 100; i++ {
+		var files = map[string][]byte{
+			"a": data[:60],              // header intact, image data missing
+			"b": []byte("not an image"), // header can't be read
+			"c": data,
+		}
+		for kind, content := range files { // interleaved, so workers and processDir count at the same time
+			if err := os.WriteFile(filepath.Join(in, fmt.Sprintf("%03d%s.png", i, kind)), content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"png"}, Depth: 1, Jobs: 4, Convert: "jpg"})
+	if res.Copied != 300 || res.Failed != 0 {
+		t.Errorf("copied %d, failed %d, want 300 and 0", res.Copied, res.Failed)
+	}
+	if res.Converted != 100 || res.NoConvert != 200 {
+		t.Errorf("converted %d, not converted %d, want 100 and 200", res.Converted, res.NoConvert)
+	}
+}
+
+func TestMoveKeepsReencodedSources(t *testing.T) {
+	// a thumbnail, turned or converted copy can't stand in for the original, Move is refused before anything is copied
+	for name, cfg := range map[string]Config{
+		"thumbnails":  {ThumbWidth: 8, ThumbHeight: 8},
+		"auto rotate": {AutoRotate: true},
+		"convert":     {Convert: "jpg"},
+	} {
+		var in, out string = t.TempDir(), t.TempDir()
+		var src string = filepath.Join(in, "a.png")
+		if err := os.WriteFile(src, pngData(t), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg.In, cfg.Out, cfg.Ext, cfg.Move = []string{in}, out, []string{"png"}, true
+		cfg.Stdout, cfg.Stderr = io.Discard, io.Discard
+		if _, err := Organize(context.Background(), cfg); err == nil {
+			t.Errorf("%s: no error with Move", name)
+		}
+		if _, err := os.Stat(src); err != nil {
+			t.Errorf("%s: source is gone: %v", name, err)
+		}
+		if files := listTree(t, out); len(files) != 0 {
+			t.Errorf("%s: copied %v", name, files)
+		}
+	}
+	// identical copies still move
+	var in, out string = t.TempDir(), t.TempDir()
+	writeTree(t, in, "a.png")
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"png"}, Move: true})
+	if res.Moved != 1 || len(listTree(t, in)) != 0 {
+		t.Errorf("moved %d, left %v in input, want 1 and nothing", res.Moved, listTree(t, in))
+	}
+}
+
+func TestConvertBMP(t *testing.T) {
+	// BMP scans of each bit depth are decoded and re-encoded, what can't be read is copied as it is
+	var in, out string = t.TempDir(), t.TempDir()
+	var opaque = image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+	var alpha = image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	alpha.Set(1, 1, color.NRGBA{255, 0, 0, 128})
+	var files = map[string][]byte{}
+	for name, img := range map[string]image.Image{
+		"8bit":  image.NewPaletted(image.Rect(0, 0, 8, 4), color.Palette{color.Black, color.White}),
+		"24bit": opaque,
+		"32bit": alpha,
+	} {
+		var buf bytes.Buffer
+		if err := bmp.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		files[name+".bmp"] = buf.Bytes()
+	}
+	// rows stored from the top, given as a negative height
+	var topDown []byte = append([]byte(nil), files["24bit.bmp"]...)
+	topDown[22], topDown[23], topDown[24], topDown[25] = 0xfc, 0xff, 0xff, 0xff
+	files["topdown.bmp"] = topDown
+	// RLE compressed and 16 bits per pixel aren't supported
+	var rle []byte = append([]byte(nil), files["8bit.bmp"]...)
+	rle[30] = 1
+	files["rle.bmp"] = rle
+	var bpp16 []byte = append([]byte(nil), files["24bit.bmp"]...)
+	bpp16[28] = 16
+	files["16bit.bmp"] = bpp16
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(in, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"bmp"}, Keep: true, Convert: "png"})
+	if res.Copied != 6 || res.Converted != 4 || res.NoConvert != 2 || res.Failed != 0 {
+		t.Errorf("copied %d, converted %d, not converted %d, failed %d, want 6, 4, 2, 0", res.Copied, res.Converted, res.NoConvert, res.Failed)
+	}
+	for _, name := range []string{"8bit.png", "24bit.png", "32bit.png", "topdown.png", "rle.bmp", "16bit.bmp"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
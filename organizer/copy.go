@@ -0,0 +1,264 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Copy, link and verify single files
+ */
+
+package organizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+ * Compute SHA-256 of a file
+ * content is streamed so large files don't have to fit into memory
+ * @return hex encoded hash
+ */
+func hashFile(path string) (string, error) {
+	in, err := os.Open(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, in)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/*
+ * Check that a copy is identical to its source
+ * sizes are compared first, then SHA-256 of both files read from disk again
+ */
+func verify(from string, to string) error {
+	inFrom, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	inTo, err := os.Stat(to)
+	if err != nil {
+		return err
+	}
+	if inFrom.Size() != inTo.Size() {
+		return fmt.Errorf("verify %s: size differs from %s", to, from)
+	}
+	hashFrom, err := hashFile(from)
+	if err != nil {
+		return err
+	}
+	hashTo, err := hashFile(to)
+	if err != nil {
+		return err
+	}
+	if hashFrom != hashTo {
+		return fmt.Errorf("verify %s: content differs from %s", to, from)
+	}
+	return nil
+}
+
+/*
+ * Create a hard link instead of copying
+ * like copyFile(), the link is created under a temporary name and renamed, so Force
+ * replaces an existing destination atomically
+ * @param h if not nil, content is written to h as well
+ * @return size of the file
+ */
+func link(from string, to string, h hash.Hash) (int64, error) {
+	from, to = longPath(from), longPath(to)
+	info, err := os.Stat(from)
+	if err != nil {
+		return 0, err
+	}
+	// reserve a temporary name next to the destination
+	tmp, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+
+	err = os.Link(from, tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	err = os.Rename(tmp.Name(), to)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if h != nil {
+		in, err := os.Open(to)
+		if err != nil {
+			return 0, err
+		}
+		defer in.Close()
+		_, err = io.Copy(h, in)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return info.Size(), nil
+}
+
+/*
+ * Reader that fails with ErrCanceled once ctx is done
+ * used by copyFile() so a large file doesn't keep copying after Ctrl+C
+ */
+type cancelReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c cancelReader) Read(p []byte) (int, error) {
+	if c.ctx.Err() != nil {
+		return 0, ErrCanceled
+	}
+	return c.r.Read(p)
+}
+
+/*
+ * Reader that reports how many bytes each read returned
+ * used to show the progress of a large file, see organizer.track
+ */
+type progressReader struct {
+	r    io.Reader
+	read func(n int)
+}
+
+func (pr progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.read(n)
+	}
+	return n, err
+}
+
+/*
+ * Copy a single file from one place to another
+ * content is written to a temporary file next to the destination and renamed once complete,
+ * so an interrupted copy never leaves a truncated image under the final name
+ * @param modTime set as access and modification time of the copy, zero value leaves it untouched
+ * @param mode    permission bits of the copy, set before it's renamed, 0 for 0644
+ * @param h       if not nil, content is written to h as well
+ * @param buf     copy buffer, reused across calls by each worker
+ * @param lim     bandwidth limit shared by all workers, nil for none
+ * @param wrap    if not nil, wraps the reader of the source, e.g. to report progress
+ * @param ctx     abort and remove the partial copy once it's done
+ * @return number of bytes copied
+ */
+func copyFile(ctx context.Context, from string, to string, modTime time.Time, mode os.FileMode, h hash.Hash, buf []byte, lim *limiter, wrap func(io.Reader) io.Reader) (written int64, err error) {
+	from, to = longPath(from), longPath(to)
+	in, err := os.Open(from)
+
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	// remove temporary file on any error
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	// hide os.File's ReadFrom, io.CopyBuffer would use it and ignore buf
+	var w io.Writer = struct{ io.Writer }{out}
+	if h != nil {
+		w = io.MultiWriter(out, h)
+	}
+	var r io.Reader = cancelReader{ctx, in}
+	if lim != nil {
+		r = limitReader{ctx, r, lim}
+	}
+	if wrap != nil {
+		r = wrap(r)
+	}
+	written, err = io.CopyBuffer(w, r, buf)
+	if err != nil {
+		return 0, err
+	}
+	err = finish(out, modTime, mode)
+	if err != nil {
+		return 0, err
+	}
+	return written, os.Rename(out.Name(), to)
+}
+
+/*
+ * Close a complete temporary file and set its times and permission bits, so it's ready to be renamed
+ * the mode is set last, a read-only file can't have its times changed everywhere
+ * @param mode permission bits, 0 for 0644, os.CreateTemp creates files readable by owner only
+ */
+func finish(out *os.File, modTime time.Time, mode os.FileMode) error {
+	err := out.Close()
+	if err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		err = os.Chtimes(out.Name(), modTime, modTime)
+		if err != nil {
+			return err
+		}
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	return os.Chmod(out.Name(), mode)
+}
+
+/*
+ * Write a new file atomically like copyFile(), with content produced by write
+ * @param modTime set as access and modification time of the file, zero value leaves it untouched
+ * @param mode    permission bits of the file, 0 for 0644
+ * @param h       if not nil, content is written to h as well
+ * @return size of the file
+ */
+func writeAtomic(to string, modTime time.Time, mode os.FileMode, h hash.Hash, write func(w io.Writer) error) (written int64, err error) {
+	to = longPath(to)
+	out, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	// remove temporary file on any error
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+	var w io.Writer = out
+	if h != nil {
+		w = io.MultiWriter(out, h)
+	}
+	err = write(w)
+	if err != nil {
+		return 0, err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	err = finish(out, modTime, mode)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(out.Name(), to)
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Links and renames across devices, not told apart on other platforms
+ */
+
+package organizer
+
+/*
+ * Check whether a link or rename failed because from and to are on different devices
+ * errors have no numbers to tell here, e.g. on Plan 9, so a failed link or rename stays a failure
+ */
+func isCrossDevice(err error) bool {
+	return false
+}
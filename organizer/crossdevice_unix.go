@@ -0,0 +1,22 @@
+//go:build unix
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Links and renames across devices on Unix
+ */
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+/*
+ * Check whether a link or rename failed because from and to are on different devices
+ * the file has to be copied instead
+ */
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Links and renames across volumes on Windows
+ */
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ERROR_NOT_SAME_DEVICE, Windows doesn't return EXDEV
+const errNotSameDevice syscall.Errno = 17
+
+/*
+ * Check whether a link or rename failed because from and to are on different volumes
+ * the file has to be copied instead
+ */
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errNotSameDevice)
+}
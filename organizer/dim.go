@@ -0,0 +1,47 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Read the dimensions of images without decoding them
+ */
+
+package organizer
+
+import (
+	"bufio"
+	"image"
+	_ "image/gif" // JPEG and PNG are registered by thumb.go
+	"os"
+
+	_ "golang.org/x/image/bmp" // uncompressed BMP, the standard library has no decoder for it
+)
+
+/*
+ * Read width and height of an image from its header, as it's shown
+ * a JPEG photo turned by its EXIF orientation, e.g. taken in portrait, has width and height swapped
+ * @return an error if the format isn't one image.DecodeConfig knows, e.g. RAW, HEIC or a video
+ */
+func imageSize(path string) (int, int, error) {
+	config, format, err := decodeHeader(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if format == "jpeg" {
+		if orientation, err := exifOrientation(path); err == nil && orientation >= 5 { // turned by 90 degrees
+			return config.Height, config.Width, nil
+		}
+	}
+	return config.Width, config.Height, nil
+}
+
+/*
+ * Read the header of an image
+ * @return its dimensions and the name of its format, e.g. "jpeg", see image.DecodeConfig
+ */
+func decodeHeader(path string) (image.Config, string, error) {
+	in, err := os.Open(longPath(path))
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	defer in.Close()
+	return image.DecodeConfig(bufio.NewReader(in))
+}
@@ -0,0 +1,237 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Read the date a photo was taken from its EXIF data
+ */
+
+package organizer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags
+const exifTagIFD uint16 = 0x8769              // pointer to Exif sub-IFD
+const exifTagDateTimeOriginal uint16 = 0x9003 // date and time the photo was taken
+const exifTagOrientation uint16 = 0x0112      // how the camera was held, 1 = upright
+const exifTagMake uint16 = 0x010F             // camera manufacturer
+const exifTagModel uint16 = 0x0110            // camera model
+const exifTagLensModel uint16 = 0xA434        // lens model
+const exifTagISO uint16 = 0x8827              // ISO speed
+const exifTagExposureTime uint16 = 0x829A     // shutter speed in seconds
+const exifTagFNumber uint16 = 0x829D          // aperture
+const exifTagFocalLength uint16 = 0x920A      // focal length in millimeters
+
+// a raw EXIF (TIFF) entry
+type exifEntry struct {
+	typ   uint16 // TIFF data type, 2 = ASCII
+	count uint32 // number of values
+	value []byte // raw value bytes, a slice of the segment they were read from
+	order binary.ByteOrder
+}
+
+/*
+ * Read EXIF entries of IFD0 and the Exif sub-IFD from a JPEG file
+ * @see https://www.cipa.jp/std/documents/e/DC-008-2012_E.pdf
+ */
+func readExif(path string) (map[uint16]exifEntry, error) {
+	seg, err := readExifSegment(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseTiff(seg[6:])
+}
+
+/*
+ * Read the APP1 segment holding EXIF data from a JPEG file
+ * only the markers up to the APP1 segment are read, the image itself is not decoded
+ * @return segment content starting with the "Exif" header, without marker and length
+ */
+func readExifSegment(path string) ([]byte, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	r := bufio.NewReader(in)
+	var marker = make([]byte, 4)
+	if _, err := io.ReadFull(r, marker[:2]); err != nil || marker[0] != 0xFF || marker[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+	// walk segments until we find APP1 with an Exif header
+	for {
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xFF || marker[1] == 0xDA || marker[1] == 0xD9 { // start of scan or end of image
+			return nil, errors.New("no EXIF data")
+		}
+		var length int = int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, errors.New("invalid JPEG segment")
+		}
+		if marker[1] != 0xE1 { // not APP1, skip
+			if _, err := r.Discard(length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var seg = make([]byte, length)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return nil, err
+		}
+		if len(seg) < 6 || string(seg[:6]) != "Exif\x00\x00" { // APP1 may also hold XMP
+			continue
+		}
+		return seg, nil
+	}
+}
+
+/*
+ * Parse IFD0 and the Exif sub-IFD of a TIFF structure
+ */
+func parseTiff(tiff []byte) (map[uint16]exifEntry, error) {
+	if len(tiff) < 8 {
+		return nil, errors.New("invalid EXIF data")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid EXIF byte order")
+	}
+	var entries = make(map[uint16]exifEntry)
+	var offset uint32 = order.Uint32(tiff[4:])
+	for _, ifd := range []int{0, 1} { // IFD0, then Exif sub-IFD
+		if ifd == 1 {
+			e, ok := entries[exifTagIFD]
+			if !ok || len(e.value) < 4 {
+				break
+			}
+			offset = order.Uint32(e.value)
+		}
+		if int(offset)+2 > len(tiff) {
+			return nil, errors.New("invalid EXIF offset")
+		}
+		var n int = int(order.Uint16(tiff[offset:]))
+		for i := 0; i < n; i++ {
+			var p int = int(offset) + 2 + i*12
+			if p+12 > len(tiff) {
+				break
+			}
+			var e = exifEntry{typ: order.Uint16(tiff[p+2:]), count: order.Uint32(tiff[p+4:]), order: order}
+			var size int = int(e.count) * exifTypeSize(e.typ)
+			if size <= 4 { // value fits into the offset field
+				e.value = tiff[p+8 : p+8+size]
+			} else {
+				var v int = int(order.Uint32(tiff[p+8:]))
+				if v < 0 || v+size > len(tiff) {
+					continue
+				}
+				e.value = tiff[v : v+size]
+			}
+			entries[order.Uint16(tiff[p:])] = e
+		}
+	}
+	return entries, nil
+}
+
+/*
+ * Byte size of a single value of a TIFF data type
+ */
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // byte, ASCII, signed byte, undefined
+		return 1
+	case 3, 8: // short, signed short
+		return 2
+	case 4, 9, 11: // long, signed long, float
+		return 4
+	case 5, 10, 12: // rational, signed rational, double
+		return 8
+	}
+	return 0
+}
+
+/*
+ * Read the date a JPEG photo was taken from EXIF DateTimeOriginal
+ */
+func exifDate(path string) (time.Time, error) {
+	entries, err := readExif(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	e, ok := entries[exifTagDateTimeOriginal]
+	if !ok || e.typ != 2 {
+		return time.Time{}, errors.New("no EXIF DateTimeOriginal")
+	}
+	return time.ParseInLocation("2006:01:02 15:04:05", strings.TrimRight(string(e.value), "\x00 "), time.Local)
+}
+
+/*
+ * Read the EXIF orientation of a JPEG photo
+ * @return 1 to 8 as defined by TIFF, 1 if the tag is missing
+ */
+func exifOrientation(path string) (int, error) {
+	entries, err := readExif(path)
+	if err != nil {
+		return 0, err
+	}
+	e, ok := entries[exifTagOrientation]
+	if !ok || e.typ != 3 || len(e.value) < 2 {
+		return 1, nil
+	}
+	var v int = int(e.order.Uint16(e.value))
+	if v < 1 || v > 8 {
+		return 1, nil
+	}
+	return v, nil
+}
+
+/*
+ * Get an ASCII EXIF value without its trailing NUL and spaces
+ * @return empty string if the tag is missing or not ASCII
+ */
+func exifString(entries map[uint16]exifEntry, tag uint16) string {
+	e, ok := entries[tag]
+	if !ok || e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+/*
+ * Get the first value of an unsigned short or long EXIF entry
+ */
+func exifUint(entries map[uint16]exifEntry, tag uint16) (uint32, bool) {
+	e, ok := entries[tag]
+	switch {
+	case ok && e.typ == 3 && len(e.value) >= 2:
+		return uint32(e.order.Uint16(e.value)), true
+	case ok && e.typ == 4 && len(e.value) >= 4:
+		return e.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+/*
+ * Get the first value of an unsigned rational EXIF entry
+ * @return false if the tag is missing or its denominator is 0
+ */
+func exifRational(entries map[uint16]exifEntry, tag uint16) (float64, bool) {
+	e, ok := entries[tag]
+	if !ok || e.typ != 5 || len(e.value) < 8 || e.order.Uint32(e.value[4:]) == 0 {
+		return 0, false
+	}
+	return float64(e.order.Uint32(e.value)) / float64(e.order.Uint32(e.value[4:])), true
+}
@@ -0,0 +1,93 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Write an HTML index of the copies in the output directory
+ */
+
+package organizer
+
+import (
+	"html/template"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// name of the gallery in the output directory
+const galleryName string = "index.html"
+
+// extensions browsers show in an <img>, others are listed by name
+var galleryImages = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".webp": true, ".avif": true, ".svg": true}
+
+// a single page with inline CSS, so it works offline and without anything else
+var galleryPage = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; padding: 8px; background: #111; color: #ccc; font-family: sans-serif; }
+h1 { margin: 8px 0 16px; font-size: 1.1em; font-weight: normal; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(180px, 1fr)); gap: 8px; }
+.grid a { display: block; aspect-ratio: 1; overflow: hidden; background: #222; color: #aaa; font-size: 0.8em; text-decoration: none; }
+.grid img { display: block; width: 100%; height: 100%; object-fit: cover; }
+.grid span { display: block; padding: 8px; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}, {{len .Files}} files</h1>
+<div class="grid">
+{{range .Files}}<a href="{{.URL}}" title="{{.Name}}">{{if .Image}}<img src="{{.URL}}" alt="{{.Name}}" loading="lazy">{{else}}<span>{{.Name}}</span>{{end}}</a>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// a file shown by the gallery
+type galleryFile struct {
+	Name  string // path relative to the output directory
+	URL   string // Name escaped for href and src
+	Image bool   // shown as a picture
+}
+
+/*
+ * Write index.html into out with a grid of the copies of this run, those of earlier runs aren't shown
+ * links are relative so the directory can be moved
+ * @param copies destinations in out, in any order, the grid is sorted by path
+ * @return path of the gallery
+ */
+func writeGallery(out string, copies []string) (string, error) {
+	var files []galleryFile = make([]galleryFile, 0, len(copies))
+	var gallery string = filepath.Join(out, galleryName)
+	for _, path := range copies {
+		rel, err := filepath.Rel(out, path)
+		if err != nil {
+			return "", err
+		}
+		var parts []string = strings.Split(filepath.ToSlash(rel), "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		files = append(files, galleryFile{
+			Name:  filepath.ToSlash(rel),
+			URL:   strings.Join(parts, "/"),
+			Image: galleryImages[strings.ToLower(filepath.Ext(path))],
+		})
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].Name < files[b].Name })
+	var data = struct {
+		Title string
+		Files []galleryFile
+	}{filepath.Base(out), files}
+	_, err := writeAtomic(gallery, time.Time{}, 0, nil, func(w io.Writer) error {
+		return galleryPage.Execute(w, data)
+	})
+	if err != nil {
+		return "", err
+	}
+	return gallery, nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of the gallery
+ */
+
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGalleryThisRun(t *testing.T) {
+	// copies of an earlier run stay out of the page, those of this one are in it
+	var in, out string = t.TempDir(), t.TempDir()
+	writeTree(t, out, "earlier.jpg")
+	writeTree(t, in, "a b.jpg", "d/c.png", "d/c.xmp", "e.txt")
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"jpg", "png"}, Depth: 10, Keep: true, Sidecars: true, Gallery: true})
+	if res.Copied != 2 || res.Gallery != filepath.Join(out, galleryName) {
+		t.Fatalf("copied %d, gallery %q, want 2 and %s", res.Copied, res.Gallery, filepath.Join(out, galleryName))
+	}
+	data, err := os.ReadFile(res.Gallery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page string = string(data)
+	for _, want := range []string{`<img src="a%20b.jpg"`, `<img src="c.png"`, `<span>c.xmp</span>`, "3 files"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("gallery has no %s", want)
+		}
+	}
+	for _, unwanted := range []string{"earlier.jpg", "e.txt", galleryName} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("gallery shows %s", unwanted)
+		}
+	}
+	if strings.Index(page, "a%20b.jpg") > strings.Index(page, "c.png") {
+		t.Error("gallery isn't sorted by path")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Skip files and directories matching gitignore-style patterns
+ */
+
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// a single line of an ignore file
+type ignorePattern struct {
+	glob    string // pattern in slash form
+	path    bool   // match against path relative to root instead of name
+	dirOnly bool   // pattern ended with "/"
+}
+
+// ignore patterns of an input directory, see loadIgnore
+type ignoreList struct {
+	root     string // input directory the patterns are relative to
+	patterns []ignorePattern
+}
+
+/*
+ * Load gitignore-style patterns from a file
+ * blank lines and lines starting with "#" are skipped, a trailing "/" only matches directories,
+ * patterns containing "/" match the path relative to root, others match names at any depth
+ * note: negation with "!" and "**" are not supported
+ * @param path file to read patterns from
+ * @param root input directory the patterns apply to
+ */
+func loadIgnore(path string, root string) (*ignoreList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseIgnore(data, path, root)
+}
+
+/*
+ * Parse the content of an ignore file, see loadIgnore
+ * @param path file the patterns were read from, for error messages
+ */
+func parseIgnore(data []byte, path string, root string) (*ignoreList, error) {
+	var l = &ignoreList{root: root}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.path = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if _, err := filepath.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q", path, line)
+		}
+		p.glob = line
+		l.patterns = append(l.patterns, p)
+	}
+	return l, nil
+}
+
+/*
+ * Check whether a file or directory matches one of the ignore patterns
+ * a nil list matches nothing
+ */
+func (l *ignoreList) match(path string, isDir bool) bool {
+	if l == nil || len(l.patterns) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range l.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		var target string = filepath.Base(path)
+		if p.path {
+			target = rel
+		}
+		if ok, _ := filepath.Match(p.glob, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of named pipes in the input on Unix
+ */
+
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestNamedPipe(t *testing.T) {
+	// a pipe nobody writes to would block the copy or Sniff forever
+	for _, sniff := range []bool{false, true} {
+		var in, out string = t.TempDir(), t.TempDir()
+		if err := os.WriteFile(filepath.Join(in, "a.jpg"), []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), 0o644); err != nil { // enough for Sniff
+			t.Fatal(err)
+		}
+		if err := syscall.Mkfifo(filepath.Join(in, "pipe.jpg"), 0o644); err != nil {
+			t.Skip("no named pipes here:", err)
+		}
+		res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"jpg"}, Depth: 10, Keep: true, Sniff: sniff})
+		if res.Copied != 1 || res.Failed != 0 || res.Irregular != 1 {
+			t.Errorf("sniff %v: copied %d, failed %d, irregular %d, want 1, 0, 1", sniff, res.Copied, res.Failed, res.Irregular)
+		}
+		if got := listTree(t, out); !reflect.DeepEqual(got, []string{"a.jpg"}) {
+			t.Errorf("sniff %v: output %v, want only a.jpg", sniff, got)
+		}
+	}
+}
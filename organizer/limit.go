@@ -0,0 +1,90 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Limit copy bandwidth shared by all workers
+ */
+
+package organizer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+ * Token bucket of bytes, shared by all workers so the limit applies to their sum
+ * the bucket holds up to one second of traffic, a read larger than that goes into debt
+ * and the next reader waits until it's paid off
+ */
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64   // bytes per second
+	tokens float64   // bytes that may pass right now, negative while in debt
+	last   time.Time // last refill
+
+	now func() time.Time // clock, time.Now but in tests
+}
+
+func newLimiter(rate int64) *limiter {
+	return &limiter{rate: float64(rate), tokens: float64(rate), last: time.Now(), now: time.Now}
+}
+
+/*
+ * Take n bytes from the bucket
+ * @return how long to wait until the bucket is out of debt, 0 if it isn't
+ */
+func (l *limiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var now time.Time = l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens < 0 {
+		return time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	return 0
+}
+
+/*
+ * Take n bytes from the bucket, waiting as long as it's in debt
+ * @return ErrCanceled if ctx is done while waiting
+ */
+func (l *limiter) wait(ctx context.Context, n int) error {
+	var delay time.Duration = l.take(n)
+	if delay == 0 {
+		return nil
+	}
+	var timer = time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ErrCanceled
+	case <-timer.C:
+		return nil
+	}
+}
+
+/*
+ * Reader that passes every read through a limiter
+ */
+type limitReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *limiter
+}
+
+func (lr limitReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.wait(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
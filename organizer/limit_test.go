@@ -0,0 +1,76 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of the copy bandwidth limit
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimiterRate(t *testing.T) {
+	// a fake clock advanced by every wait, so the measured rate doesn't depend on the machine
+	var tests = []struct {
+		name  string
+		rate  int64
+		total int // bytes read
+		chunk int // bytes per read
+	}{
+		{"small reads", 1000, 10000, 100},
+		{"reads of a second", 1000, 10000, 1000},
+		{"reads larger than the bucket", 1000, 10000, 2500},
+		{"1MB/s", 1 << 20, 10 << 20, 32 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var clock time.Time = time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+			var l *limiter = newLimiter(tt.rate)
+			l.last = clock
+			l.now = func() time.Time { return clock }
+			for read := 0; read < tt.total; read += tt.chunk {
+				clock = clock.Add(l.take(tt.chunk)) // wait as told
+			}
+			// the bucket starts full, that second's worth passes right away, the rest at the rate
+			var elapsed time.Duration = clock.Sub(time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC))
+			var want time.Duration = time.Duration(float64(tt.total-int(tt.rate)) / float64(tt.rate) * float64(time.Second))
+			if diff := elapsed - want; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("%d bytes took %s, want %s", tt.total, elapsed, want)
+			}
+			if rate := float64(tt.total-int(tt.rate)) / elapsed.Seconds(); rate > float64(tt.rate)*1.001 {
+				t.Errorf("measured %.0f bytes/s, limit %d", rate, tt.rate)
+			}
+		})
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	// a known data size through the real clock, 1.5MB at 1MB/s takes half a second after the first full bucket
+	const rate = 1 << 20
+	var data = make([]byte, rate*3/2)
+	var l *limiter = newLimiter(rate)
+	var start time.Time = time.Now()
+	n, err := io.CopyBuffer(io.Discard, limitReader{context.Background(), bytes.NewReader(data), l}, make([]byte, 32<<10))
+	var elapsed time.Duration = time.Since(start)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("copied %d bytes, %v", n, err)
+	}
+	if elapsed < 450*time.Millisecond {
+		t.Errorf("%d bytes took %s at %d bytes/s, want at least 500ms", n, elapsed, rate)
+	}
+}
+
+func TestLimitReaderCanceled(t *testing.T) {
+	var l *limiter = newLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := io.Copy(io.Discard, limitReader{ctx, bytes.NewReader(make([]byte, 100)), l})
+	if err != ErrCanceled {
+		t.Errorf("got %v, want ErrCanceled", err)
+	}
+}
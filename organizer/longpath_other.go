@@ -0,0 +1,28 @@
+//go:build !windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Long path support, nothing to do outside of Windows
+ */
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+/*
+ * Return path as it is, only Windows needs a prefix for long paths
+ */
+func longPath(path string) string {
+	return path
+}
+
+/*
+ * Check whether an error is caused by a path or filename that is too long
+ */
+func isPathTooLong(err error) bool {
+	return errors.Is(err, syscall.ENAMETOOLONG)
+}
@@ -0,0 +1,44 @@
+//go:build windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Long path support on Windows
+ */
+
+package organizer
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// longest directory path Windows APIs accept without the \\?\ prefix, MAX_PATH minus room for a 8.3 filename
+const maxPath int = 248
+
+// ERROR_FILENAME_EXCED_RANGE
+const errFilenameExcedRange syscall.Errno = 206
+
+/*
+ * Prefix a long absolute path with \\?\ so Windows accepts it beyond MAX_PATH
+ * short and relative paths are returned as they are
+ */
+func longPath(path string) string {
+	if len(path) < maxPath || !filepath.IsAbs(path) || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	path = filepath.Clean(path)        // \\?\ turns off normalization, e.g. of "/" and ".."
+	if strings.HasPrefix(path, `\\`) { // \\server\share\... -> \\?\UNC\server\share\...
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
+
+/*
+ * Check whether an error is caused by a path that is too long
+ */
+func isPathTooLong(err error) bool {
+	return errors.Is(err, errFilenameExcedRange) || errors.Is(err, syscall.ENAMETOOLONG)
+}
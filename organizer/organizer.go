@@ -0,0 +1,2051 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Extract images from sub-folders into a single directory
+ */
+
+// Package organizer is the core of imo: it searches directories for images and copies them
+// into a single directory. The command line tool only turns flags into a Config and prints
+// the Result.
+package organizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// log levels
+const LOG_QUIET int = 0 // nothing but the summary
+const LOG_ERROR int = 1 // error messages
+const LOG_INFO int = 2  // error messages and a line per file
+const LOG_DEBUG int = 3 // everything
+
+// copy buffer size used if Config.BufSize is not set, io.Copy's 32KB are slow for large images
+const DefaultBufSize int = 1 << 20
+
+// size from which a file's copy is reported on its own by Config.Progress, see Result.Copying, e.g. a video
+const LargeFileSize int64 = 64 << 20
+
+// files and directories created by operating systems rather than users, always skipped, compared case-insensitively
+var DefaultSystemFiles = []string{
+	".DS_Store", ".Spotlight-V100", ".Trashes", ".fseventsd", // macOS
+	"Thumbs.db", "thumb.db", "ehthumbs.db", "desktop.ini", "$RECYCLE.BIN", "System Volume Information", // Windows
+}
+
+// returned by Organize, wrapped, if the files found won't fit into Out
+var ErrNoSpace = errors.New("not enough free space")
+
+// returned by Organize if Config.Confirm declined the run, nothing has been copied then
+var ErrDeclined = errors.New("declined")
+
+// returned by Organize, wrapped together with ctx.Err(), if ctx was done before the run finished
+var ErrCanceled = errors.New("canceled")
+
+/*
+ * Options of a run
+ * the zero value of every field is a sensible default, except Depth and Ext
+ */
+type Config struct {
+	In          []string          // input directories
+	Out         string            // output directory
+	Ext         []string          // file extensions, lowercase and without dot
+	Exclude     []string          // file extensions to skip even if they're in Ext, lowercase and without dot
+	Depth       int               // search depth, 0 = unlimited, 1 = files right under each input and in its sub-folders
+	NoRecurse   bool              // only take files right under each input, sub-folders aren't listed, overrides Depth
+	MinDepth    int               // skip files shallower than this depth
+	Sort        string            // order of files within each directory, "name", "mtime" or "size", "" = name
+	Follow      bool              // follow symlinked directories
+	ScanOnly    bool              // scan without copy
+	Stats       bool              // count files and their size per extension regardless of Ext, without copy, implies ScanOnly
+	Plan        bool              // scan without copy and list files whose content isn't in Out yet, implies ScanOnly
+	Histogram   bool              // count found files per day taken, like ByDate, without copy, implies ScanOnly
+	Prune       bool              // with Move, remove source directories left empty afterwards
+	Move        bool              // delete source files after copy, not with thumbnails, AutoRotate or Convert
+	Keep        bool              // keep original filenames instead of sequential IDs
+	Force       bool              // overwrite existing destination files
+	Dedup       bool              // skip files whose content has already been copied
+	Collision   string            // suffix of kept names that are taken, "number" or "" for foo-1.jpg, "hash" for foo-a1b2c3d4.jpg, where identical files collapse
+	Newest      bool              // of files with the same destination name only copy the newest, replacing older copies, needs Keep, Tree or Template
+	NoTime      bool              // don't preserve modification times
+	NoPerm      bool              // don't preserve permission bits, copies are created with 0644
+	Retries     int               // retry copies failing with transient errors like EIO this many times
+	Jobs        int               // number of copy workers, at least 1
+	ScanJobs    int               // read this many directories ahead in parallel, e.g. on a network share, 0 or 1 to read one at a time
+	RateLimit   int64             // copy at most this many bytes per second across all workers, 0 = no limit
+	BufSize     int               // copy buffer size per worker in bytes, 0 = 1MB
+	Prefix      bool              // prefix filenames with parent folder name
+	Parents     int               // prefix filenames with this many parent folder names below the input joined by "-", overrides Prefix
+	MinSize     int64             // skip files smaller than this many bytes
+	MinWidth    int               // skip images narrower than this many pixels, by their header, 0 = no limit
+	MinHeight   int               // skip images lower than this many pixels, see MinWidth
+	KeepNoDim   bool              // with MinWidth or MinHeight, take files whose dimensions can't be read instead of skipping them, e.g. RAW or HEIC
+	AllowEmpty  bool              // take zero-byte files as well, by default they're skipped as corrupt
+	Match       *regexp.Regexp    // only take files whose name matches, nil to take all
+	NoMatch     *regexp.Regexp    // skip files whose name matches, nil to skip none
+	Since       time.Time         // skip files modified before, zero value for no lower bound
+	Until       time.Time         // skip files modified after, zero value for no upper bound
+	Sniff       bool              // detect image type by content instead of extension
+	ByDate      bool              // sort copies into YYYY/MM sub-folders
+	Tree        bool              // keep the directory structure below each input instead of flattening, implies Keep unless Template is set
+	KeepEmpty   bool              // with Tree, create every directory walked, even without a file to copy, e.g. an empty album
+	FlatDepth   int               // keep this many directory levels below each input as sub-folders and flatten the rest, 0 = flatten all, ignored with Tree
+	ByExt       bool              // sort copies into sub-folders named after their extension, before ByDate
+	Structure   string            // sub-folders by a template like "{year}/{month}/{ext}", see Template, replaces ByExt and ByDate
+	NormExt     bool              // name copies with one spelling per type, e.g. .jpg for .jpeg, extensions are lowercase either way
+	IDPerExt    bool              // count sequential IDs per extension instead of across all files
+	Pad         int               // zero-pad IDs to this width
+	Name        string            // base of sequential names, "photo" gives photo_1.jpg, "" for bare IDs
+	Template    string            // filename template like "{parent}_{seq}{ext}" or "{camera}_{iso}_{date}{ext}", overrides Keep and Prefix
+	Hidden      bool              // take hidden files and directories as well, names starting with "."
+	SystemFiles []string          // names of further files and directories to skip like DefaultSystemFiles, case-insensitive
+	HashName    bool              // name copies after their SHA-256 like "a1b2c3d4e5f60718.jpg", overrides Template, implies Dedup
+	ThumbWidth  int               // write thumbnails fitting into ThumbWidth x ThumbHeight instead of copies, 0 to copy, overrides Link
+	ThumbHeight int               // see ThumbWidth
+	AutoRotate  bool              // turn JPEG photos upright according to their EXIF orientation, such photos are copied even with Link
+	Quality     int               // JPEG quality of turned and converted photos, 1 to 100, 0 = DefaultQuality
+	Convert     string            // re-encode images to this format, "jpg" or "png", named after it, "" to copy them as they are, ignored with thumbnails
+	Link        bool              // create hard links instead of copies
+	Verify      bool              // compare checksums of source and copy
+	Gallery     bool              // write an index.html of the copies of this run into Out afterwards
+	Sidecars    bool              // copy .xmp and .aae files of the same name along with each image, named like its copy
+	Xattrs      bool              // copy extended attributes, the user namespace on Linux, Linux and macOS only
+	MaxFiles    int               // stop after this many files, 0 = no limit
+	Sample      int               // only take this many of the files found, picked at random, 0 = all
+	Seed        int64             // seed of the random picks of Sample, the same one picks the same files again, 0 = a time-based one
+	NoCheck     bool              // don't check free space of Out before copying
+	MinFree     int               // stop copying before less than this percentage of the filesystem of Out would be free, 0 = no limit
+	IgnoreFile  string            // file with ignore patterns, defaults to .imoignore in each input directory
+	State       string            // file recording copied sources, those unchanged since are skipped on the next run, "" for none
+	Manifest    io.Writer         // CSV of every copy, nil to disable
+	Commands    io.Writer         // print shell commands copying the files here instead of copying them, nil to copy
+	FS          fs.FS             // search this filesystem instead of the OS one, e.g. fstest.MapFS in benchmarks; In are slash-separated paths within it, only ScanOnly runs without Plan, Sniff or Manifest, Out is ignored
+	LogLevel    int               // log level, see LOG_*
+	Stdout      io.Writer         // info and debug messages, os.Stdout if nil
+	Stderr      io.Writer         // error messages, os.Stderr if nil
+	Logger      *slog.Logger      // structured logger for all messages instead of Stdout and Stderr, still filtered by LogLevel
+	ErrLog      io.Writer         // every error message as a key=value line with the files concerned, regardless of LogLevel, nil to disable
+	Progress    func(Result)      // called with current counters whenever a file is found or copied, from several goroutines
+	Confirm     func(Result) bool // called with what a scan found before anything is copied, false stops the run with ErrDeclined
+}
+
+/*
+ * Counters of a run
+ * JSON field names are the field names in camel case, e.g. bytesCopied
+ */
+type Result struct {
+	Found          int                `json:"found"`          // qualified files
+	FoundIn        []int              `json:"foundIn"`        // qualified files per input directory
+	CopiedIn       []int              `json:"copiedIn"`       // files copied or linked per input directory
+	FailedIn       []int              `json:"failedIn"`       // failures per input directory, those of the output directory, e.g. Gallery, aren't included
+	Copied         int                `json:"copied"`         // files copied
+	Retried        int                `json:"retried"`        // copies that only succeeded after a retry
+	Sidecars       int                `json:"sidecars"`       // .xmp and .aae files copied along with their images by Sidecars
+	Thumbs         int                `json:"thumbs"`         // copies written as thumbnails, included in Copied
+	Rotated        int                `json:"rotated"`        // copies turned upright by AutoRotate, included in Copied
+	Converted      int                `json:"converted"`      // copies re-encoded by Convert, included in Copied
+	NoConvert      int                `json:"noConvert"`      // files copied as they are because Convert can't decode them
+	Linked         int                `json:"linked"`         // files hard-linked instead of copied
+	BytesCopied    int64              `json:"bytesCopied"`    // bytes written by copies
+	BytesFound     int64              `json:"bytesFound"`     // size of found files, only counted with ScanOnly
+	New            int                `json:"new"`            // files whose content isn't in Out yet, only counted with Plan
+	Present        int                `json:"present"`        // files whose content is already in Out, or found before in this run, only counted with Plan
+	Taken          int                `json:"taken"`          // files queued for copy, or listed with ScanOnly, counted against MaxFiles
+	Pruned         int                `json:"pruned"`         // empty source directories removed by Prune
+	Moved          int                `json:"moved"`          // files moved (source removed after copy)
+	Skipped        int                `json:"skipped"`        // files skipped because destination already exists
+	Duplicates     int                `json:"duplicates"`     // files skipped because identical content was already copied
+	Replaced       int                `json:"replaced"`       // older files of the same name replaced by a newer one with Newest, in Out or found before
+	Outdated       int                `json:"outdated"`       // files not copied with Newest because a newer one of the same name exists
+	TooSmall       int                `json:"tooSmall"`       // files skipped because they're smaller than MinSize
+	TooSmallDim    int                `json:"tooSmallDim"`    // images skipped because they're smaller than MinWidth x MinHeight
+	NoDim          int                `json:"noDim"`          // files whose dimensions couldn't be read for MinWidth and MinHeight, skipped unless KeepNoDim
+	EmptyFiles     int                `json:"emptyFiles"`     // zero-byte files skipped unless AllowEmpty, not included in TooSmall
+	NameFiltered   int                `json:"nameFiltered"`   // files skipped by Match or NoMatch
+	OutOfRange     int                `json:"outOfRange"`     // files skipped because they were modified before Since or after Until
+	Ignored        int                `json:"ignored"`        // files and directories skipped by ignore patterns
+	Corrected      int                `json:"corrected"`      // files whose extension doesn't match the type detected by Sniff, copies get the right one
+	Resumed        int                `json:"resumed"`        // files skipped because State records them as copied by an earlier run
+	Hidden         int                `json:"hidden"`         // hidden files and directories skipped without Hidden
+	SystemFiles    int                `json:"systemFiles"`    // files and directories skipped as DefaultSystemFiles or Config.SystemFiles
+	Irregular      int                `json:"irregular"`      // named pipes, sockets and devices skipped, those with a name of Ext or any with Sniff
+	SymlinkSkipped int                `json:"symlinkSkipped"` // symlinked directories skipped without Follow
+	SymlinkLoops   int                `json:"symlinkLoops"`   // directories skipped with Follow because they've been visited already
+	LastID         int                `json:"lastID"`         // highest ID used for a sequential name
+	Gallery        string             `json:"gallery"`        // index.html written by Gallery, "" if none
+	Commands       int                `json:"commands"`       // files whose commands were printed to Commands
+	ExtStats       map[string]ExtStat `json:"extStats"`       // files per extension with Stats, lowercase and without dot, "" for none
+	CopiedByExt    map[string]int     `json:"copiedByExt"`    // files copied or linked per extension, lowercase and without dot
+	Days           map[string]int     `json:"days"`           // files found per day taken with Histogram, YYYY-MM-DD
+	MaxReached     bool               `json:"maxReached"`     // stopped because MaxFiles was reached
+	Sampled        int                `json:"sampled"`        // files picked by Sample, at most Sample
+	Seed           int64              `json:"seed"`           // seed used by Sample, to pick the same files again
+	LowSpace       bool               `json:"lowSpace"`       // stopped because free space of Out would have dropped below MinFree
+	Remaining      int                `json:"remaining"`      // files found by the search before the run that weren't processed, with LowSpace
+	Copying        []FileProgress     `json:"copying"`        // files of LargeFileSize or more being copied, oldest first, only reported to Config.Progress
+
+	// error counters
+	Failed            int `json:"failed"`            // failed operations
+	DirError          int `json:"dirError"`          // failed to read from directory
+	PermDenied        int `json:"permDenied"`        // directories skipped because they can't be read, counted in DirError as well
+	CopyError         int `json:"copyError"`         // failed to copy
+	RemoveError       int `json:"removeError"`       // copied but failed to remove source in move mode
+	VerifyError       int `json:"verifyError"`       // copy differs from source, the copy has been removed
+	XattrError        int `json:"xattrError"`        // copied but failed to copy extended attributes
+	Panics            int `json:"panics"`            // files whose processing panicked, e.g. on a malformed image
+	DepthLimitReached int `json:"depthLimitReached"` // stopped by maximum depth, you may want to raise Depth to do a deeper search
+}
+
+// files of an extension counted by Stats
+type ExtStat struct {
+	Count int   `json:"count"` // number of files
+	Size  int64 `json:"size"`  // total size in bytes
+}
+
+// a large file being copied, see Result.Copying
+type FileProgress struct {
+	Source string `json:"source"` // file being copied
+	Size   int64  `json:"size"`   // size in bytes
+	Copied int64  `json:"copied"` // bytes copied so far
+}
+
+// copy job queue, filled by processDir and consumed by workers
+type job struct {
+	from    string      // copy from
+	to      string      // copy to
+	modTime time.Time   // modification time to set, zero value leaves it untouched
+	mode    os.FileMode // permission bits to set, 0 for 0644
+	hash    string      // content hash if already computed by Dedup or Collision
+	root    string      // input directory the file was found in
+	info    os.FileInfo // source file, recorded by State
+	in      int         // index of root in Config.In
+	convert bool        // re-encode to Config.Convert
+}
+
+// a copy job held back by Newest until every file of the same name has been seen
+type candidate struct {
+	job
+	modTime time.Time // modification time of the source, even with NoTime
+}
+
+// state of a single run
+type organizer struct {
+	ctx     context.Context
+	cfg     Config
+	res     Result
+	id      int            // image ID, the highest one handed out with IDPerExt, only used by the walk, see nextID
+	extIDs  map[string]int // image ID per extension, used by IDPerExt, like id
+	jobs    chan job       // copy job queue
+	out     os.FileInfo    // output directory, to recognize it under another path
+	root    string         // input directory being processed
+	in      int            // index of root in Config.In, into FoundIn, CopiedIn and FailedIn
+	ignores *ignoreList    // ignore patterns of the input directory being processed
+
+	// resolved absolute paths of directories walked with Follow
+	visited map[string]bool
+
+	// names of system files and directories to skip, DefaultSystemFiles and Config.SystemFiles
+	system []string
+
+	// content hash of copied files -> destination, used by Dedup, guarded by mu as workers forget failed copies
+	// with Plan, content hash of files in Out and new files found before
+	seen map[string]string
+
+	// newest file per lowercase destination, queued once all inputs are walked, used by Newest
+	newest  map[string]int // index into pending
+	pending []candidate
+
+	// lowercase destinations handed out in this run, used by uniqueDest to avoid collisions
+	// with files that are still queued and therefore don't exist on disk yet, to the content
+	// hash of their source with Collision "hash", "" otherwise
+	reserved   map[string]string
+	reservedMu sync.Mutex
+
+	// directory of moved files -> input directory, used by Prune
+	movedFrom map[string]string
+
+	// bandwidth limit shared by workers, nil without RateLimit
+	limiter *limiter
+
+	// CSV writer of Manifest, nil if disabled
+	manifest *csv.Writer
+
+	// sources copied by earlier runs and CSV writer appending to State, nil if disabled
+	done  map[string]stateEntry
+	state *csv.Writer
+
+	// guards counters shared between processDir and workers:
+	// Found, Failed, Copied, Linked, Moved, BytesCopied, CopiedByExt, CopyError, RemoveError, VerifyError, XattrError, Panics, NoConvert
+	// as well as manifest, state, movedFrom and seen
+	mu sync.Mutex
+
+	// warns once if Xattrs isn't supported by the platform or filesystem
+	xattrWarn sync.Once
+
+	// warns once if State can't be written
+	stateWarn sync.Once
+
+	// stops the run for MinFree, jobs dropped since are counted in dropped, guarded by mu,
+	// expected is the number of files found by the search before the run
+	stop      context.CancelFunc
+	dropped   int
+	expected  int
+	spaceWarn sync.Once
+
+	// files picked by Sample so far, out of offered files found, and the source of the picks
+	sample  []sampled
+	offered int
+	rng     *rand.Rand
+
+	// destination directories created by a mkdir printed to Commands, guarded by mu
+	madeDirs map[string]bool
+
+	// large files being copied, reported by progress, guarded by mu
+	copying []*FileProgress
+
+	// destinations of this run's copies and their sidecars, shown by Gallery, guarded by mu
+	copies []string
+}
+
+/*
+ * Search the input directories for images and copy them to the output directory
+ * failures of single files or directories are counted in Result,
+ * an error is only returned if the run couldn't start, or ErrCanceled if ctx was done,
+ * check with errors.Is, the error wraps ctx.Err() as well, e.g. context.DeadlineExceeded
+ */
+func Organize(ctx context.Context, cfg Config) (Result, error) {
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Stderr == nil {
+		cfg.Stderr = os.Stderr
+	}
+	if cfg.Jobs < 1 {
+		cfg.Jobs = 1
+	}
+	if cfg.Plan || cfg.Stats || cfg.Histogram {
+		cfg.ScanOnly = true
+	}
+	if cfg.ThumbWidth > 0 && cfg.ThumbHeight > 0 { // thumbnails need to be written
+		cfg.Link = false
+		cfg.Convert = ""
+	}
+	if cfg.Tree && cfg.Template == "" { // rebuilt folders keep their original files
+		cfg.Keep = true
+	}
+	if cfg.Commands != nil { // nothing is written, so there's nothing to check or confirm
+		cfg.NoCheck = true
+		cfg.Confirm = nil
+	}
+	if cfg.HashName { // identical content gets the same name, so only one of them can be copied
+		cfg.Dedup = true
+	}
+	if cfg.BufSize <= 0 {
+		cfg.BufSize = DefaultBufSize
+	}
+	// part of a filename, so it can't point into another directory, a leading dot would hide copies
+	cfg.Name = strings.TrimLeft(sanitize(cfg.Name), ".")
+	if cfg.Quality <= 0 {
+		cfg.Quality = DefaultQuality
+	}
+	if cfg.Sample > 0 && cfg.Seed == 0 { // chosen once, so the search before the run picks the same files
+		cfg.Seed = time.Now().UnixNano()
+	}
+	// convert pathes to absolute pathes
+	var ins []string
+	for _, in := range cfg.In {
+		if cfg.FS != nil { // paths within FS are relative to its root already
+			if !fs.ValidPath(path.Clean(in)) {
+				return Result{}, fmt.Errorf("invalid path %q in FS", in)
+			}
+			ins = append(ins, path.Clean(in))
+			continue
+		}
+		abs, err := filepath.Abs(in)
+		if err != nil {
+			return Result{}, err
+		}
+		ins = append(ins, abs)
+	}
+	out, err := filepath.Abs(cfg.Out)
+	if err != nil {
+		return Result{}, err
+	}
+	// copies, hashes and file types are read from the OS
+	if cfg.FS != nil && (!cfg.ScanOnly || cfg.Plan || cfg.Sniff || cfg.Manifest != nil || cfg.MinWidth > 0 || cfg.MinHeight > 0) {
+		return Result{}, errors.New("FS only supports scan-only runs without Plan, Sniff, Manifest or minimum dimensions")
+	}
+	if cfg.Commands != nil && (cfg.ThumbWidth > 0 || cfg.AutoRotate || cfg.Convert != "" || cfg.Gallery) {
+		return Result{}, errors.New("Commands can't print thumbnails, turned or converted copies or a gallery")
+	}
+	if cfg.Template != "" {
+		if err := checkTemplate(cfg.Template); err != nil {
+			return Result{}, err
+		}
+	}
+	if cfg.Structure != "" {
+		if err := checkStructure(cfg.Structure); err != nil {
+			return Result{}, err
+		}
+		if cfg.ByExt || cfg.ByDate {
+			return Result{}, errors.New("Structure replaces ByExt and ByDate, use {ext} and {year}/{month} instead")
+		}
+	}
+	if _, ok := convertFormats[cfg.Convert]; !ok && cfg.Convert != "" {
+		return Result{}, fmt.Errorf("can't convert to %q, use jpg or png", cfg.Convert)
+	}
+	// the original would be gone with only a smaller or re-encoded image left
+	if cfg.Move && !cfg.ScanOnly && (cfg.ThumbWidth > 0 && cfg.ThumbHeight > 0 || cfg.AutoRotate || cfg.Convert != "") {
+		return Result{}, errors.New("Move only removes sources of identical copies, not of thumbnails, turned or converted ones")
+	}
+	switch cfg.Collision {
+	case "", "number", "hash":
+	default:
+		return Result{}, fmt.Errorf("unknown collision strategy %q, use number or hash", cfg.Collision)
+	}
+	switch cfg.Sort {
+	case "", "name", "mtime", "size":
+	default:
+		return Result{}, fmt.Errorf("unknown sort order %q, use name, mtime or size", cfg.Sort)
+	}
+	// load ignore patterns of every input before doing anything
+	var ignores = make([]*ignoreList, len(ins))
+	for i, in := range ins {
+		if cfg.IgnoreFile != "" {
+			ignores[i], err = loadIgnore(cfg.IgnoreFile, in)
+		} else if cfg.FS != nil {
+			var data []byte
+			data, err = fs.ReadFile(cfg.FS, path.Join(in, ".imoignore"))
+			if err == nil {
+				ignores[i], err = parseIgnore(data, path.Join(in, ".imoignore"), in)
+			} else if errors.Is(err, fs.ErrNotExist) { // .imoignore is optional
+				err = nil
+			}
+		} else {
+			ignores[i], err = loadIgnore(filepath.Join(in, ".imoignore"), in)
+			if os.IsNotExist(err) { // .imoignore is optional
+				err = nil
+			}
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	// sources copied by earlier runs are skipped by the pre-scan as well
+	var done map[string]stateEntry
+	var state *csv.Writer
+	if cfg.State != "" {
+		done, err = loadState(cfg.State)
+		if err != nil {
+			return Result{}, err
+		}
+		if !cfg.ScanOnly {
+			stateFile, err := os.OpenFile(cfg.State, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return Result{}, err
+			}
+			defer stateFile.Close()
+			state = csv.NewWriter(stateFile)
+		}
+	}
+
+	// search the inputs first if the free space check or Confirm need to know what would be copied,
+	// hard links take no space
+	var check bool = !cfg.Link && !cfg.NoCheck
+	var expected int // files found by the search, to tell how many remain if MinFree stops the run
+	if !cfg.ScanOnly && (check || cfg.Confirm != nil || cfg.MinFree > 0) {
+		found, err := scan(ctx, cfg)
+		if err != nil {
+			return Result{}, err
+		}
+		expected = found.Found
+		if check {
+			if err := checkSpace(cfg, out, found); err != nil {
+				return Result{}, err
+			}
+		}
+		if cfg.Confirm != nil && found.Found > 0 && !cfg.Confirm(found) {
+			if ctx.Err() != nil { // e.g. Ctrl+C at a prompt
+				return Result{}, fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+			}
+			return Result{}, ErrDeclined
+		}
+	}
+
+	parent := ctx // MinFree cancels the run's own context, not a cancellation by the caller
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	var o = &organizer{
+		ctx:       ctx,
+		stop:      stop,
+		expected:  expected,
+		rng:       rand.New(rand.NewSource(cfg.Seed)),
+		madeDirs:  make(map[string]bool),
+		cfg:       cfg,
+		res:       Result{FoundIn: make([]int, len(ins)), CopiedIn: make([]int, len(ins)), FailedIn: make([]int, len(ins)), CopiedByExt: make(map[string]int), ExtStats: make(map[string]ExtStat), Days: make(map[string]int)},
+		extIDs:    make(map[string]int),
+		jobs:      make(chan job),
+		visited:   make(map[string]bool),
+		seen:      make(map[string]string),
+		reserved:  make(map[string]string),
+		movedFrom: make(map[string]string),
+		newest:    make(map[string]int),
+		system:    append(append([]string{}, DefaultSystemFiles...), cfg.SystemFiles...),
+		done:      done,
+		state:     state,
+	}
+	if cfg.Plan {
+		o.hashOutput(out)
+	}
+	if cfg.RateLimit > 0 {
+		o.limiter = newLimiter(cfg.RateLimit)
+	}
+	if cfg.Manifest != nil {
+		o.manifest = csv.NewWriter(cfg.Manifest)
+		o.manifest.Write([]string{"source", "destination", "size", "sha256"})
+	}
+	// create output directory if not exists
+	if cfg.FS == nil && cfg.Commands == nil {
+		os.Mkdir(out, os.ModePerm)
+		o.out, _ = os.Stat(out) // nil if it couldn't be created, copies will fail then
+	}
+	// start copy workers
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Jobs; i++ {
+		wg.Add(1)
+		go o.worker(&wg)
+	}
+	// process directories, id keeps counting across inputs
+	for i, in := range ins {
+		o.root = in
+		o.in = i
+		o.ignores = ignores[i]
+		o.processDir(in, out)
+	}
+	if cfg.Sample > 0 {
+		o.res.Seed = cfg.Seed
+		o.takeSample()
+	}
+	// only now it's known which file of a name is the newest
+	for i, c := range o.pending {
+		if o.canceled() {
+			o.mu.Lock()
+			o.dropped += len(o.pending) - i
+			o.mu.Unlock()
+			break
+		}
+		o.jobs <- c.job
+	}
+	// wait for queued copies to finish
+	close(o.jobs)
+	wg.Wait()
+	// remove directories emptied by moving
+	if cfg.Move && cfg.Prune && cfg.Commands == nil && !o.canceled() {
+		o.prune()
+	}
+	// write remaining manifest rows
+	if o.manifest != nil {
+		o.manifest.Flush()
+		if err := o.manifest.Error(); err != nil {
+			o.logf(LOG_ERROR, "%s", slog.Any("error", err))
+		}
+	}
+	// index the copies made so far, an interrupted run has some too
+	if cfg.Gallery && !cfg.ScanOnly {
+		o.res.Gallery, err = writeGallery(out, o.copies)
+		if err != nil {
+			o.res.Failed++ // record this incident
+			o.logf(LOG_ERROR, "gallery: %s", slog.Any("error", err))
+		}
+	}
+	o.res.LastID = o.id
+	o.res.MaxReached = o.maxReached()
+	if parent.Err() != nil {
+		return o.res, fmt.Errorf("%w: %w", ErrCanceled, parent.Err())
+	}
+	if o.res.LowSpace { // files the walk didn't get to, and those it had queued
+		o.res.Remaining = max(0, o.expected-o.res.Found) + o.dropped
+	}
+	return o.res, nil
+}
+
+/*
+ * Search the input directories of cfg with ScanOnly, nothing is copied or logged
+ * @return what a run of cfg would find
+ */
+func scan(ctx context.Context, cfg Config) (Result, error) {
+	var scan Config = cfg
+	scan.ScanOnly = true
+	scan.Move = false
+	scan.NoCheck = true
+	scan.Confirm = nil
+	scan.Manifest = nil
+	scan.Progress = nil
+	scan.LogLevel = LOG_QUIET // errors are reported by the real run
+	scan.ErrLog = nil
+	scan.MinFree = 0
+	return Organize(ctx, scan)
+}
+
+/*
+ * Check that the files found by scan() fit into the free space of out
+ * skipped and duplicate files count as well, so the estimate errs on the safe side
+ * the check is skipped with a debug message if free space can't be determined
+ */
+func checkSpace(cfg Config, out string, res Result) error {
+	// Organize has created out if needed
+	free, _, err := freeSpace(out)
+	if err != nil {
+		if cfg.LogLevel >= LOG_DEBUG {
+			logf(cfg, LOG_DEBUG, "skip free space check: %s", slog.Any("error", err))
+		}
+		return nil
+	}
+	if uint64(res.BytesFound) > free {
+		return fmt.Errorf("%w on %s: %s required, %s available", ErrNoSpace, out,
+			FormatSize(res.BytesFound), FormatSize(int64(free)))
+	}
+	return nil
+}
+
+/*
+ * Process a given directory
+ * the tree is walked by fs.WalkDir, depth is the number of directories between from and a file
+ * symlinked directories are skipped unless Follow is set
+ * at LOG_DEBUG, each directory is logged with the number of files found directly in it once it's done
+ * @param from	search this directory for images
+ * @param to    once found, copy image to this directory
+ * @see https://golang.org/pkg/io/fs/#WalkDir
+ */
+func (o *organizer) processDir(from string, to string) {
+	o.walk(from, from, to)
+}
+
+/*
+ * Walk a directory tree for processDir
+ * @param from input directory, depth is relative to it
+ * @param dir  walk this directory, from itself or a symlinked directory under it
+ * @param to   once found, copy image to this directory
+ */
+func (o *organizer) walk(from string, dir string, to string) {
+	var fsys fs.FS = o.dirFS(dir)
+	// directories being walked, innermost last, with the files they contributed so far
+	type dirCount struct {
+		path  string
+		found int
+	}
+	var open []dirCount
+	// log a summary of every directory WalkDir has left by the time it reaches path, "" for all
+	var leave = func(path string) {
+		for len(open) > 0 {
+			var top dirCount = open[len(open)-1]
+			if path != "" && (path == top.path || strings.HasPrefix(path, top.path+string(filepath.Separator))) {
+				return
+			}
+			o.logf(LOG_DEBUG, "done %s: %d files", slog.String("path", top.path), slog.Int("found", top.found))
+			open = open[:len(open)-1]
+		}
+	}
+	defer leave("")
+	// handle a single file, either from WalkDir or from sortedFiles()
+	var file = func(path string, entry os.DirEntry) {
+		// skip anything matching .imoignore
+		if o.ignores.match(path, false) {
+			o.res.Ignored++ // record this incident
+			o.logf(LOG_INFO, "ignore %s", slog.String("path", path))
+			return
+		}
+		// skip files above minimum depth
+		rel, err := filepath.Rel(from, path)
+		if err != nil || strings.Count(rel, string(filepath.Separator)) < o.cfg.MinDepth {
+			return
+		}
+		var found int = o.res.Found // only processDir changes it
+		o.processFile(filepath.Dir(path), entry, to)
+		if len(open) > 0 {
+			open[len(open)-1].found += o.res.Found - found
+		}
+	}
+	// WalkDir sees files by name, any other order is applied per directory
+	var byName bool = o.cfg.Sort == "" || o.cfg.Sort == "name"
+	// read directories ahead that WalkDir is going to descend into, the checks below decide for sure
+	if o.cfg.ScanJobs > 1 {
+		var reads int = 1 // sortedFiles lists each directory as well
+		if !byName {
+			reads = 2
+		}
+		p := newPrefetchFS(fsys, o.cfg.ScanJobs, reads, func(name string, entry fs.DirEntry) bool {
+			var path string = filepath.Join(dir, filepath.FromSlash(name))
+			rel, err := filepath.Rel(from, path)
+			if err != nil || o.isSystem(entry.Name()) || (!o.cfg.Hidden && strings.HasPrefix(entry.Name(), ".")) || o.ignores.match(path, true) {
+				return false
+			}
+			return !o.cfg.NoRecurse && (o.cfg.Depth == 0 || strings.Count(rel, string(filepath.Separator))+1 <= o.cfg.Depth)
+		})
+		defer p.stop()
+		fsys = p
+	}
+	fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		var path string = dir // full path, names are relative to dir
+		if name != "." {
+			path = filepath.Join(dir, filepath.FromSlash(name))
+		}
+		if o.cfg.LogLevel >= LOG_DEBUG {
+			leave(path)
+		}
+		// stop if we've been canceled or have got enough files
+		if o.canceled() || o.maxReached() {
+			return filepath.SkipAll
+		}
+		// if we encounter an directory error, this would likely to be
+		// 1. directory not exist
+		// 2. directory permissions
+		// TODO: show suggestions for other errors
+		if err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) { // report the full path, not the name within fsys
+				pathErr.Path = path
+			}
+			o.res.DirError++ // record this incident
+			o.mu.Lock()
+			o.res.Failed++
+			o.res.FailedIn[o.in]++
+			o.mu.Unlock()
+			if errors.Is(err, fs.ErrPermission) { // its siblings may still be readable
+				o.res.PermDenied++
+				o.logf(LOG_ERROR, "permission denied, skipping %s", slog.String("path", path))
+				return nil
+			}
+			o.logf(LOG_ERROR, "%s", slog.Any("error", err))
+			return nil // carry on with the rest of the tree
+		}
+		if name == "." { // nothing to filter on dir itself
+			// don't copy to itself
+			if o.isOutput(dir) {
+				return filepath.SkipAll
+			}
+			if o.cfg.Follow && !o.visit(path) {
+				o.res.SymlinkLoops++ // record this incident
+				return filepath.SkipAll
+			}
+			o.logf(LOG_DEBUG, "scan %s", slog.String("path", dir))
+			if o.cfg.LogLevel >= LOG_DEBUG {
+				open = append(open, dirCount{path: dir})
+			}
+			o.keepDir(from, dir, to)
+			if !byName {
+				o.sortedFiles(fsys, name, dir, file)
+			}
+			return nil
+		}
+		// WalkDir doesn't follow symlinks, check whether this one points to a directory
+		var isDir bool = entry.IsDir()
+		var isLink bool = false // symlink to a directory
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if info, err := fs.Stat(fsys, name); err == nil && info.IsDir() {
+				isDir = true
+				isLink = true
+			}
+		}
+		if !isDir {
+			if byName {
+				file(path, entry)
+			}
+			return nil
+		}
+		// returning SkipDir for anything but a real directory would skip its siblings
+		var skip error = filepath.SkipDir
+		if !entry.IsDir() {
+			skip = nil
+		}
+		// only files right under the input directory, not counted as DepthLimitReached, nothing was missed by mistake
+		if o.cfg.NoRecurse {
+			o.logf(LOG_DEBUG, "skip sub-directory %s", slog.String("path", path))
+			return skip
+		}
+		// skip system directories, e.g. $RECYCLE.BIN
+		if o.isSystem(entry.Name()) {
+			o.res.SystemFiles++ // record this incident
+			o.logf(LOG_DEBUG, "skip system directory %s", slog.String("path", path))
+			return skip
+		}
+		// skip hidden directories, e.g. .thumbnails
+		if !o.cfg.Hidden && strings.HasPrefix(entry.Name(), ".") {
+			o.res.Hidden++ // record this incident
+			o.logf(LOG_DEBUG, "skip hidden directory %s", slog.String("path", path))
+			return skip
+		}
+		// skip anything matching .imoignore
+		if o.ignores.match(path, true) {
+			o.res.Ignored++ // record this incident
+			o.logf(LOG_INFO, "ignore %s", slog.String("path", path))
+			return skip
+		}
+		// count directories between from and path
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return nil
+		}
+		var depth int = strings.Count(rel, string(filepath.Separator)) // 0 for entries right under from
+		// don't copy to itself, the output directory may be anywhere under from
+		if o.isOutput(path) {
+			o.logf(LOG_DEBUG, "skip output directory %s", slog.String("path", path))
+			return skip
+		}
+		// stop if we've reached maximum depth, symlink loops are caught by visit() instead
+		if o.cfg.Depth > 0 && depth+1 > o.cfg.Depth {
+			o.res.DepthLimitReached++ // record this incident
+			return skip
+		}
+		if isLink {
+			if !o.cfg.Follow {
+				o.res.SymlinkSkipped++ // record this incident
+				o.logf(LOG_INFO, "skip symlinked directory %s, use -L to follow", slog.String("path", path))
+				return nil
+			}
+			o.walk(from, path, to) // walk the link target as if it was a sub-directory
+			return nil
+		}
+		// remember real directories so links back into them are detected
+		if o.cfg.Follow && !o.visit(path) {
+			o.res.SymlinkLoops++ // record this incident
+			return filepath.SkipDir
+		}
+		o.logf(LOG_DEBUG, "scan %s", slog.String("path", path))
+		if o.cfg.LogLevel >= LOG_DEBUG {
+			open = append(open, dirCount{path: path})
+		}
+		o.keepDir(from, path, to)
+		if !byName {
+			o.sortedFiles(fsys, name, path, file)
+		}
+		return nil
+	})
+}
+
+/*
+ * Create the directory of a walked one in the output directory for KeepEmpty, whether it has files to copy or not
+ * those skipped by depth, ignore patterns or as hidden aren't walked and so aren't created either
+ * @param dir directory under from about to be listed
+ */
+func (o *organizer) keepDir(from string, dir string, to string) {
+	if !o.cfg.KeepEmpty || !o.cfg.Tree || o.cfg.ScanOnly {
+		return
+	}
+	rel, err := filepath.Rel(from, dir)
+	if err != nil || rel == "." { // the output directory itself exists already
+		return
+	}
+	var path string = filepath.Join(to, rel)
+	if o.cfg.Commands != nil { // printed like the directory of a file, see printCommands
+		o.mu.Lock()
+		if !o.madeDirs[path] {
+			o.madeDirs[path] = true
+			_, err = io.WriteString(o.cfg.Commands, "mkdir -p -- "+shellQuote(path)+"\n")
+		}
+		o.mu.Unlock()
+	} else {
+		err = os.MkdirAll(path, os.ModePerm)
+	}
+	if err != nil {
+		o.fail(o.in, err, slog.String("source", dir), slog.String("destination", path))
+		return
+	}
+	o.logf(LOG_DEBUG, "keep directory %s", slog.String("destination", path))
+}
+
+/*
+ * Handle the files directly in dir in the order given by Sort, oldest or smallest first
+ * ties keep the order by name, so IDs are the same on every run
+ * @param name dir within fsys
+ * @param file called for every file, symlinks to directories are left to WalkDir
+ */
+func (o *organizer) sortedFiles(fsys fs.FS, name string, dir string, file func(path string, entry os.DirEntry)) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil { // WalkDir reports it
+		return
+	}
+	type sortEntry struct {
+		entry os.DirEntry
+		info  os.FileInfo
+	}
+	var files []sortEntry
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if info, err := fs.Stat(fsys, path.Join(name, entry.Name())); err == nil && info.IsDir() {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil { // removed in the meantime, processFile reports it
+			files = append(files, sortEntry{entry, nil})
+			continue
+		}
+		files = append(files, sortEntry{entry, info})
+	}
+	// missing info sorts first, like a zero time or size
+	var key = func(e sortEntry) int64 {
+		if e.info == nil {
+			return 0
+		}
+		if o.cfg.Sort == "size" {
+			return e.info.Size()
+		}
+		return e.info.ModTime().UnixNano()
+	}
+	sort.SliceStable(files, func(a, b int) bool {
+		return key(files[a]) < key(files[b])
+	})
+	for _, e := range files {
+		if o.canceled() || o.maxReached() {
+			return
+		}
+		file(filepath.Join(dir, e.entry.Name()), e.entry)
+	}
+}
+
+/*
+ * Get the filesystem to walk dir in, rooted at dir
+ * os.DirFS follows dir itself if it's a symlink, like a trailing separator does for filepath.WalkDir
+ */
+func (o *organizer) dirFS(dir string) fs.FS {
+	if o.cfg.FS == nil {
+		return os.DirFS(dir)
+	}
+	sub, err := fs.Sub(o.cfg.FS, filepath.ToSlash(dir))
+	if err != nil { // dir is checked by Organize already
+		return o.cfg.FS
+	}
+	return sub
+}
+
+/*
+ * Check whether a directory is the output directory
+ * compared by file identity, so the output directory is found through symlinks
+ * or a differently spelled input path as well
+ */
+func (o *organizer) isOutput(path string) bool {
+	if o.out == nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && os.SameFile(info, o.out)
+}
+
+/*
+ * Mark a directory as visited by its resolved absolute path
+ * @return false if it has been visited before, e.g. by a symlink pointing back into the tree
+ */
+func (o *organizer) visit(path string) bool {
+	if o.cfg.FS != nil { // FS has no symlinks to resolve
+		return true
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return true // can't resolve, let ReadDir report the problem
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return true
+	}
+	if o.visited[real] {
+		o.logf(LOG_INFO, "skip %s, already visited %s", slog.String("path", path), slog.String("target", real))
+		return false
+	}
+	o.visited[real] = true
+	return true
+}
+
+/*
+ * Check whether a file or directory name is one of the system files to skip
+ * names are compared with strings.EqualFold, macOS writes .DS_Store while others may spell it .DS_STORE
+ */
+func (o *organizer) isSystem(name string) bool {
+	for _, system := range o.system {
+		if strings.EqualFold(name, system) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Process a single file found by processDir
+ * @param from directory of the file
+ * @param file entry returned by WalkDir
+ * @param to   once qualified, copy image to this directory
+ */
+func (o *organizer) processFile(from string, file os.DirEntry, to string) {
+	defer o.recoverFile(o.in, slog.String("source", filepath.Join(from, file.Name())))
+	var filename string = file.Name()                        // get filename
+	var ext string = strings.ToLower(filepath.Ext(filename)) // convert extension to lowercase for easier filtering
+	// exclude system files, e.g. .DS_Store
+	if o.isSystem(filename) {
+		o.res.SystemFiles++ // record this incident
+		o.logf(LOG_DEBUG, "skip system file %s", slog.String("source", filepath.Join(from, filename)))
+		return
+	}
+	// count every extension in Stats mode, filters below don't apply
+	if o.cfg.Stats {
+		info, err := file.Info()
+		if err != nil {
+			o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)))
+			return
+		}
+		var stat ExtStat = o.res.ExtStats[strings.TrimPrefix(ext, ".")]
+		stat.Count++
+		stat.Size += info.Size()
+		o.res.ExtStats[strings.TrimPrefix(ext, ".")] = stat
+		return
+	}
+	// skip named pipes, sockets and devices, reading one would block or never end, Sniff reads right below
+	if mode := o.fileType(from, file); !mode.IsRegular() {
+		if o.cfg.Sniff || hasExt(o.cfg.Ext, ext) { // report those that would be taken, not every device in /dev
+			o.res.Irregular++ // record this incident
+			o.logf(LOG_ERROR, "skip %s, it's a %s", slog.String("source", filepath.Join(from, filename)), slog.String("type", describeType(mode)))
+		}
+		return
+	}
+	// filter extension
+	var validExt bool = false // valid extension flag
+	var detected string       // MIME type detected by Sniff
+	if o.cfg.Sniff {          // check the detected type instead of the name
+		var err error
+		detected, err = sniffType(filepath.Join(from, filename))
+		if err != nil {
+			o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)))
+			return
+		}
+		var exts []string = sniffExt[detected] // empty if it's not an image we know
+		for i := 0; i < len(o.cfg.Ext) && !validExt; i++ {
+			validExt = hasExt(exts, "."+o.cfg.Ext[i])
+		}
+		// name the copy after the detected type, keep a matching extension as it is
+		if validExt && !hasExt(exts, ext) {
+			ext = "." + exts[0]
+		}
+	} else {
+		for i := 0; i < len(o.cfg.Ext); i++ {
+			if "."+o.cfg.Ext[i] == ext {
+				validExt = true
+				break // don't need to check the rest if we've got a correct one
+			}
+		}
+	}
+	if !validExt {
+		return
+	}
+	// exclusion wins over Ext, in Sniff mode it applies to the detected type
+	if hasExt(o.cfg.Exclude, ext) {
+		return
+	}
+	// exclude hidden files unless asked for, only those that would be taken are counted
+	if !o.cfg.Hidden && strings.HasPrefix(filename, ".") {
+		o.res.Hidden++ // record this incident
+		o.logf(LOG_DEBUG, "skip hidden file %s", slog.String("source", filepath.Join(from, filename)))
+		return
+	}
+	// filter name
+	if (o.cfg.Match != nil && !o.cfg.Match.MatchString(filename)) ||
+		(o.cfg.NoMatch != nil && o.cfg.NoMatch.MatchString(filename)) {
+		o.res.NameFiltered++ // record this incident
+		return
+	}
+	// load file properties only when an option needs them
+	var info os.FileInfo
+	if o.cfg.MinSize > 0 || o.cfg.MinFree > 0 || !o.cfg.AllowEmpty || !o.cfg.NoTime || !o.cfg.NoPerm || o.cfg.ByDate || o.cfg.Template != "" || o.cfg.Structure != "" || o.cfg.ScanOnly || o.manifest != nil || o.done != nil ||
+		!o.cfg.Since.IsZero() || !o.cfg.Until.IsZero() || o.cfg.Progress != nil || o.cfg.Newest {
+		var err error
+		info, err = file.Info()
+		if err != nil { // file may have been removed since ReadDir
+			o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)))
+			return
+		}
+	}
+	// skip zero-byte files, e.g. left by a failed download
+	if info != nil && info.Size() == 0 && !o.cfg.AllowEmpty {
+		o.res.EmptyFiles++ // record this incident
+		o.logf(LOG_INFO, "skip empty %s", slog.String("source", filepath.Join(from, filename)))
+		return
+	}
+	// filter size
+	if info != nil && info.Size() < o.cfg.MinSize {
+		o.res.TooSmall++ // record this incident
+		return
+	}
+	// filter modification time
+	if info != nil && ((!o.cfg.Since.IsZero() && info.ModTime().Before(o.cfg.Since)) ||
+		(!o.cfg.Until.IsZero() && info.ModTime().After(o.cfg.Until))) {
+		o.res.OutOfRange++ // record this incident
+		return
+	}
+	// filter dimensions, only the header is read
+	if o.cfg.MinWidth > 0 || o.cfg.MinHeight > 0 {
+		width, height, err := imageSize(filepath.Join(from, filename))
+		if err != nil {
+			o.res.NoDim++ // record this incident
+			if !o.cfg.KeepNoDim {
+				o.logf(LOG_INFO, "skip %s, can't read dimensions: %s", slog.String("source", filepath.Join(from, filename)), slog.Any("error", err))
+				return
+			}
+		} else if width < o.cfg.MinWidth || height < o.cfg.MinHeight {
+			o.res.TooSmallDim++ // record this incident
+			return
+		}
+	}
+	o.mu.Lock()
+	o.res.Found++ // record this incident
+	o.res.FoundIn[o.in]++
+	o.mu.Unlock()
+	o.progress()
+	// the source keeps its name, only the copy gets the extension of its content
+	if o.cfg.Sniff && filepath.Ext(filename) != "" && !hasExt(sniffExt[detected], strings.ToLower(filepath.Ext(filename))) {
+		o.res.Corrected++ // record this incident
+		o.logf(LOG_ERROR, "%s is %s, name the copy %s", slog.String("source", filepath.Join(from, filename)), slog.String("type", detected), slog.String("ext", ext))
+	}
+	// pick files at random with Sample, those picked are taken once the walk is over
+	if o.cfg.Sample > 0 {
+		o.pick(sampled{from: from, filename: filename, ext: ext, info: info, to: to, root: o.root, in: o.in})
+		return
+	}
+	o.takeFile(from, filename, ext, info, to)
+}
+
+/*
+ * Copy a file found by processFile, or list it in scan-only mode
+ * files copied by an earlier run, duplicates and existing files are skipped
+ * @param ext  lowercase extension of the copy with leading dot
+ * @param info nil unless an option needs it, see processFile
+ */
+func (o *organizer) takeFile(from string, filename string, ext string, info os.FileInfo, to string) {
+	defer o.recoverFile(o.in, slog.String("source", filepath.Join(from, filename)))
+	// skip sources an earlier run has copied, unless they've changed since
+	if e, ok := o.done[filepath.Join(from, filename)]; ok && e.matches(info) {
+		o.res.Resumed++ // record this incident
+		o.logf(LOG_INFO, "skip %s, copied by an earlier run", slog.String("source", filepath.Join(from, filename)))
+		// its ID stays taken, so the files after it get the names they'd have got in the earlier run
+		if !o.cfg.ScanOnly && !o.cfg.HashName && ((!o.cfg.Keep && o.cfg.Template == "") || strings.Contains(o.cfg.Template, "{seq}")) {
+			if o.cfg.NormExt {
+				ext = normExt(ext)
+			}
+			o.nextID(ext)
+		}
+		return
+	}
+	if o.cfg.ScanOnly { // skip copy in scan-only mode
+		o.res.Taken++ // count against MaxFiles
+		o.res.BytesFound += info.Size()
+		if o.cfg.Histogram { // the date ByDate would sort it into
+			o.res.Days[photoDate(filepath.Join(from, filename), ext, info).Format("2006-01-02")]++
+		}
+		var hash string // content hash, only computed with Plan or a manifest
+		if o.cfg.Plan || o.manifest != nil {
+			var err error
+			hash, err = hashFile(filepath.Join(from, filename))
+			if err != nil {
+				o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)))
+				return
+			}
+		}
+		if o.cfg.Plan { // list only what is missing in the output directory
+			if dest, ok := o.seen[hash]; ok {
+				o.res.Present++ // record this incident
+				o.logf(LOG_INFO, "present %s as %s", slog.String("source", filepath.Join(from, filename)), slog.String("destination", dest))
+			} else {
+				o.res.New++ // record this incident
+				o.seen[hash] = filepath.Join(from, filename)
+				o.logf(LOG_QUIET, "new %s", slog.String("source", filepath.Join(from, filename)))
+			}
+		} else {
+			o.logf(LOG_INFO, "%s", slog.String("source", filepath.Join(from, filename)))
+		}
+		// record found file without destination for a preview
+		if o.manifest != nil {
+			o.mu.Lock()
+			o.manifest.Write([]string{filepath.Join(from, filename), "", strconv.FormatInt(info.Size(), 10), hash})
+			o.mu.Unlock()
+		}
+		return
+	}
+	// copy file
+	var cpFrom string = filepath.Join(from, filename) // copy from
+	if o.cfg.NormExt {                                // filters above saw the original spelling
+		ext = normExt(ext)
+	}
+	// name copies after the format they're converted to, images already in it are copied as they are
+	var convert bool = false
+	if o.cfg.Convert != "" {
+		if _, format, err := decodeHeader(cpFrom); err != nil {
+			o.mu.Lock()
+			o.res.NoConvert++ // record this incident, workers count those whose data turns out broken
+			o.mu.Unlock()
+			o.logf(LOG_ERROR, "can't convert %s, copy it as it is: %s", slog.String("source", cpFrom), slog.Any("error", err))
+		} else if format != convertFormats[o.cfg.Convert] {
+			convert = true
+			ext = "." + o.cfg.Convert
+		}
+	}
+	// skip content we've already copied if Dedup is enabled
+	var hash string // content hash, only computed with Dedup
+	if o.cfg.Dedup {
+		var err error
+		hash, err = hashFile(cpFrom)
+		if err != nil { // can't read the file, so copy would fail as well
+			o.fail(o.in, err, slog.String("source", cpFrom))
+			return
+		}
+		o.mu.Lock()
+		dest, ok := o.seen[hash]
+		o.mu.Unlock()
+		if ok {
+			o.res.Duplicates++ // record this incident
+			o.logf(LOG_INFO, "duplicate %s of %s", slog.String("source", cpFrom), slog.String("destination", dest))
+			return
+		}
+	}
+	var prefix string      // parent folder names if Prefix or Parents is enabled
+	if o.cfg.Parents > 0 { // e.g. 2023-Italy-Rome_ for 2023/Italy/Rome
+		var parts []string
+		if rel, err := filepath.Rel(o.root, from); err == nil && rel != "." {
+			parts = strings.Split(rel, string(filepath.Separator))
+		}
+		if len(parts) == 0 { // right in the input directory, like Prefix
+			parts = []string{filepath.Base(from)}
+		}
+		parts = parts[max(0, len(parts)-o.cfg.Parents):]
+		for i := range parts {
+			parts[i] = sanitize(parts[i])
+		}
+		prefix = strings.Join(parts, "-") + "_"
+	} else if o.cfg.Prefix {
+		prefix = sanitize(filepath.Base(from)) + "_"
+	}
+	var dir string = to // destination directory
+	if o.cfg.Tree {     // same folder relative to the input directory
+		rel, err := filepath.Rel(o.root, from)
+		if err != nil {
+			o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)))
+			return
+		}
+		dir = filepath.Join(dir, rel)
+	} else if o.cfg.FlatDepth > 0 { // only the top folders relative to the input directory
+		rel, err := filepath.Rel(o.root, from)
+		if err != nil {
+			o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)))
+			return
+		}
+		if rel != "." {
+			var parts []string = strings.Split(rel, string(filepath.Separator))
+			dir = filepath.Join(dir, filepath.Join(parts[:min(len(parts), o.cfg.FlatDepth)]...))
+		}
+	}
+	if o.cfg.ByExt { // sort into a folder per extension, e.g. jpg/
+		dir = filepath.Join(dir, strings.TrimPrefix(ext, "."))
+	}
+	if o.cfg.ByDate { // sort into YYYY/MM by the date the photo was taken
+		var date time.Time = photoDate(cpFrom, ext, info)
+		dir = filepath.Join(dir, date.Format("2006"), date.Format("01"))
+	}
+	// placeholders of Structure and Template, read from the file only if used
+	var d = templateData{
+		ext:    ext,
+		parent: filepath.Base(from),
+		name:   strings.TrimSuffix(filename, filepath.Ext(filename)),
+	}
+	if o.cfg.Structure != "" { // sort into the folders of the structure, e.g. 2019/01/jpg/
+		d.fill(o.cfg.Structure, cpFrom, ext, info)
+		dir = filepath.Join(dir, renderStructure(o.cfg.Structure, d))
+	}
+	if dir != to && o.cfg.Commands == nil { // printed along with the first file in it otherwise
+		var err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			o.fail(o.in, err, slog.String("source", filepath.Join(from, filename)), slog.String("destination", dir))
+			return
+		}
+	}
+	var cpTo string     // copy to
+	if o.cfg.HashName { // content-addressed, an existing file of that name has the same content
+		cpTo = filepath.Join(dir, hash[:hashNameLen]+ext)
+	} else if o.cfg.Template != "" { // render the template, collisions get a suffix like with Keep
+		if strings.Contains(o.cfg.Template, "{seq}") {
+			d.seq = fmt.Sprintf("%0*d", o.cfg.Pad, o.nextID(ext))
+		}
+		d.fill(o.cfg.Template, cpFrom, ext, info)
+		cpTo = filepath.Join(dir, renderTemplate(o.cfg.Template, d))
+	} else if o.cfg.Keep { // keep original filename, with the detected extension in Sniff mode
+		cpTo = filepath.Join(dir, prefix+strings.TrimSuffix(filename, filepath.Ext(filename))+ext)
+	} else { // name by sequential ID
+		var name string = fmt.Sprintf("%0*d", o.cfg.Pad, o.nextID(ext))
+		if o.cfg.Name != "" {
+			name = o.cfg.Name + "_" + name
+		}
+		cpTo = filepath.Join(dir, prefix+name+ext)
+	}
+	// with kept names, a collision is a file of the same name, Newest picks one of them instead
+	var kept bool = !o.cfg.HashName && (o.cfg.Template != "" || o.cfg.Keep)
+	var newest bool = o.cfg.Newest && kept
+	if !newest && kept && o.cfg.Collision == "hash" { // every file needs its hash, a later one may collide with it
+		if hash == "" {
+			var err error
+			hash, err = hashFile(cpFrom)
+			if err != nil { // can't read the file, so copy would fail as well
+				o.fail(o.in, err, slog.String("source", cpFrom))
+				return
+			}
+		}
+		var dup bool
+		cpTo, dup = o.hashDest(cpTo, hash)
+		if dup {
+			o.res.Duplicates++ // record this incident
+			o.logf(LOG_INFO, "duplicate %s of %s", slog.String("source", cpFrom), slog.String("destination", cpTo))
+			return
+		}
+	} else if !newest && kept {
+		cpTo = o.uniqueDest(cpTo)
+	}
+	// never clobber an existing file unless Force is set, Newest compares it below
+	if !o.cfg.Force && !newest {
+		if _, err := os.Stat(cpTo); err == nil {
+			o.res.Skipped++ // record this incident
+			o.logf(LOG_INFO, "skip existing %s", slog.String("destination", cpTo))
+			return
+		}
+	}
+	var modTime time.Time // keep source modification time unless NoTime
+	if !o.cfg.NoTime {
+		modTime = info.ModTime()
+	}
+	var mode os.FileMode // keep source permission bits unless NoPerm
+	if !o.cfg.NoPerm {
+		mode = info.Mode().Perm()
+		if info.Mode()&os.ModeSymlink != 0 { // take the target's, a symlink's own bits are meaningless
+			mode = 0
+			if target, err := os.Stat(cpFrom); err == nil {
+				mode = target.Mode().Perm()
+			}
+		}
+	}
+	if o.cfg.Dedup {
+		o.mu.Lock()
+		o.seen[hash] = cpTo // remember content when queued, the copy may still be running, see forget
+		o.mu.Unlock()
+	}
+	if newest {
+		o.keepNewest(candidate{job{cpFrom, cpTo, modTime, mode, hash, o.root, info, o.in, convert}, info.ModTime()})
+		return
+	}
+	o.res.Taken++                                                                 // count against MaxFiles
+	o.jobs <- job{cpFrom, cpTo, modTime, mode, hash, o.root, info, o.in, convert} // hand over to a worker
+}
+
+/*
+ * Hold back a copy for Newest unless a newer file of the same name has been found already
+ * or is in Out, an older one found before is dropped, an older one in Out is replaced
+ * note: files in Out are compared by their modification time, which is the source's unless NoTime
+ */
+func (o *organizer) keepNewest(c candidate) {
+	var key string = strings.ToLower(c.to)
+	if i, ok := o.newest[key]; ok {
+		o.res.Outdated++ // record this incident
+		if !c.modTime.After(o.pending[i].modTime) {
+			o.logf(LOG_INFO, "skip %s, %s is newer", slog.String("source", c.from), slog.String("newer", o.pending[i].from))
+			return
+		}
+		o.res.Replaced++ // record this incident
+		o.logf(LOG_INFO, "skip %s, %s is newer", slog.String("source", o.pending[i].from), slog.String("newer", c.from))
+		o.pending[i] = c
+		return
+	}
+	if info, err := os.Stat(c.to); err == nil && !o.cfg.Force {
+		if c.modTime.Equal(info.ModTime()) { // most likely copied by an earlier run
+			o.res.Skipped++ // record this incident
+			o.logf(LOG_INFO, "skip existing %s", slog.String("destination", c.to))
+			return
+		}
+		if c.modTime.Before(info.ModTime()) {
+			o.res.Outdated++ // record this incident
+			o.logf(LOG_INFO, "skip %s, %s is newer", slog.String("source", c.from), slog.String("newer", c.to))
+			return
+		}
+		o.res.Replaced++ // record this incident
+		o.logf(LOG_INFO, "replace %s with newer %s", slog.String("destination", c.to), slog.String("source", c.from))
+	}
+	o.newest[key] = len(o.pending)
+	o.pending = append(o.pending, c)
+	o.res.Taken++ // count against MaxFiles
+}
+
+/*
+ * Remove directories that files have been moved out of if they're empty now, deepest first,
+ * and their parents up to the input directory as they empty out
+ * directories that still contain anything, e.g. files with other extensions, are left alone
+ * note: called once all workers are done
+ */
+func (o *organizer) prune() {
+	var dirs []string
+	for dir := range o.movedFrom {
+		dirs = append(dirs, dir)
+	}
+	// deepest first, so parents are only tried once their children are gone
+	sort.Slice(dirs, func(a, b int) bool {
+		return strings.Count(dirs[a], string(filepath.Separator)) > strings.Count(dirs[b], string(filepath.Separator))
+	})
+	for _, dir := range dirs {
+		var root string = o.movedFrom[dir]
+		for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			// os.Remove only removes empty directories
+			if os.Remove(dir) != nil {
+				break
+			}
+			o.res.Pruned++ // record this incident
+			o.logf(LOG_INFO, "prune %s", slog.String("path", dir))
+			dir = filepath.Dir(dir)
+		}
+	}
+}
+
+/*
+ * Hand out the next sequential ID, per extension with IDPerExt
+ * only called from the goroutine walking the inputs, which builds the destination before queueing its job,
+ * workers get the finished path and never see an ID, so no two copies share one however many Jobs run;
+ * a walk of its own per goroutine would have to guard id and extIDs, and would number files in no stable order
+ * @param ext lowercase extension with leading dot
+ */
+func (o *organizer) nextID(ext string) int {
+	if !o.cfg.IDPerExt {
+		o.id++
+		return o.id
+	}
+	o.extIDs[ext]++
+	if o.extIDs[ext] > o.id {
+		o.id = o.extIDs[ext]
+	}
+	return o.extIDs[ext]
+}
+
+/*
+ * Remember content hashes of all files already in the output directory for Plan
+ * sub-folders are included, e.g. those created by ByDate
+ */
+func (o *organizer) hashOutput(out string) {
+	filepath.WalkDir(out, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			o.res.DirError++ // record this incident
+			o.res.Failed++
+			o.logf(LOG_ERROR, "%s", slog.Any("error", err))
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			o.fail(-1, err, slog.String("source", path))
+			return nil
+		}
+		if _, ok := o.seen[hash]; !ok {
+			o.seen[hash] = path
+		}
+		return nil
+	})
+}
+
+/*
+ * Get the type of a file for processFile, of its target for a symlink
+ * @return fs.ModeType bits, 0 for a regular file or a symlink whose target can't be read, the copy reports that
+ */
+func (o *organizer) fileType(from string, file os.DirEntry) fs.FileMode {
+	var mode fs.FileMode = file.Type()
+	if mode&fs.ModeSymlink != 0 && o.cfg.FS == nil { // WalkDir doesn't follow it, a link to a directory has been handled there
+		info, err := os.Stat(filepath.Join(from, file.Name()))
+		if err != nil {
+			return 0
+		}
+		return info.Mode().Type()
+	}
+	return mode
+}
+
+/*
+ * Name the type of a file that isn't regular, for messages
+ */
+func describeType(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeCharDevice != 0:
+		return "character device"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	case mode&fs.ModeSymlink != 0: // only in FS, see fileType
+		return "symlink"
+	}
+	return "irregular file"
+}
+
+/*
+ * Find the date a photo was taken
+ * EXIF DateTimeOriginal for JPEG files, modification time if there's no usable EXIF
+ * @param ext lowercase extension with leading dot
+ */
+func photoDate(path string, ext string, info os.FileInfo) time.Time {
+	if ext == ".jpg" || ext == ".jpeg" {
+		if d, err := exifDate(path); err == nil {
+			return d
+		}
+	}
+	return info.ModTime()
+}
+
+/*
+ * Count a failure to read or copy a file
+ * @param in    index of the input directory the file was found in, -1 for none
+ * @param attrs the file concerned for Logger, e.g. slog.String("source", path)
+ */
+func (o *organizer) fail(in int, err error, attrs ...slog.Attr) {
+	o.mu.Lock()
+	o.res.Failed++ // record this incident
+	o.res.CopyError++
+	if in >= 0 {
+		o.res.FailedIn[in]++
+	}
+	o.mu.Unlock()
+	if isPathTooLong(err) { // likely caused by a deep -tree or long template
+		o.logf(LOG_ERROR, "%s, try a shorter output directory or flatter names", append([]slog.Attr{slog.Any("error", err)}, attrs...)...)
+		return
+	}
+	o.logf(LOG_ERROR, "%s", append([]slog.Attr{slog.Any("error", err)}, attrs...)...)
+}
+
+/*
+ * Recover from a panic while processing a single file and count it as a failure, so the run goes on
+ * must be deferred directly, e.g. defer o.recoverFile(o.in, slog.String("source", path))
+ * note: the stack is logged at LOG_DEBUG
+ * @param in    index of the input directory the file was found in
+ * @param attrs the file concerned, the first one is part of the message
+ */
+func (o *organizer) recoverFile(in int, attrs ...slog.Attr) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	o.mu.Lock()
+	o.res.Failed++ // record this incident
+	o.res.Panics++
+	o.res.FailedIn[in]++
+	o.mu.Unlock()
+	o.logf(LOG_ERROR, "%s: panic: %v", append(attrs[:1:1], append([]slog.Attr{slog.Any("panic", r)}, attrs[1:]...)...)...)
+	o.logf(LOG_DEBUG, "%s", slog.String("stack", string(debug.Stack())))
+}
+
+/*
+ * Check whether copying a job leaves at least MinFree percent of the filesystem of its destination free
+ * if it doesn't, the run is stopped like by a cancellation, but reported as LowSpace
+ * the check is skipped with a warning if free space can't be determined
+ * note: the size of the source is what's expected, a thumbnail or converted copy may take less
+ * safe for concurrent use
+ */
+func (o *organizer) roomFor(j job) bool {
+	free, total, err := freeSpace(filepath.Dir(j.to))
+	if err != nil {
+		o.spaceWarn.Do(func() {
+			o.logf(LOG_ERROR, "%s, copying without a minimum of free space", slog.Any("error", err))
+		})
+		return true
+	}
+	var size uint64 = uint64(j.info.Size())
+	if free >= size && (free-size)*100 >= total*uint64(o.cfg.MinFree) {
+		return true
+	}
+	o.mu.Lock()
+	var first bool = !o.res.LowSpace // other workers may get here as well
+	o.res.LowSpace = true
+	o.mu.Unlock()
+	if first {
+		o.logf(LOG_ERROR, "stop, copying %s would leave less than %d%% free on %s", slog.String("source", j.from),
+			slog.Int("minFree", o.cfg.MinFree), slog.String("destination", filepath.Dir(j.to)))
+	}
+	o.stop()
+	return false
+}
+
+/*
+ * Check whether MaxFiles files have been queued for copy, or listed in scan-only mode
+ * note: failed copies count as well, the cap limits attempts
+ */
+func (o *organizer) maxReached() bool {
+	return o.cfg.MaxFiles > 0 && o.res.Taken >= o.cfg.MaxFiles
+}
+
+/*
+ * Check whether the context of the run is done
+ */
+func (o *organizer) canceled() bool {
+	return o.ctx.Err() != nil
+}
+
+/*
+ * Report current counters to Config.Progress
+ * Found, Copied, Linked, Moved, BytesCopied and Failed are set, others are zero
+ */
+func (o *organizer) progress() {
+	if o.cfg.Progress == nil {
+		return
+	}
+	// only counters guarded by mu, the others belong to processDir
+	o.mu.Lock()
+	var res = Result{
+		Found:       o.res.Found,
+		Copied:      o.res.Copied,
+		Linked:      o.res.Linked,
+		Moved:       o.res.Moved,
+		BytesCopied: o.res.BytesCopied,
+		Failed:      o.res.Failed,
+		FoundIn:     append([]int(nil), o.res.FoundIn...),
+		CopiedIn:    append([]int(nil), o.res.CopiedIn...),
+	}
+	for _, f := range o.copying {
+		res.Copying = append(res.Copying, *f)
+	}
+	o.mu.Unlock()
+	o.cfg.Progress(res)
+}
+
+/*
+ * Copy worker
+ * consume jobs until the queue is closed
+ */
+func (o *organizer) worker(wg *sync.WaitGroup) {
+	defer wg.Done()
+	var buf = make([]byte, o.cfg.BufSize) // copy buffer, reused for every job
+	for j := range o.jobs {
+		if o.canceled() { // drop queued jobs if we've been canceled
+			o.mu.Lock()
+			o.dropped++
+			o.mu.Unlock()
+			continue
+		}
+		o.copyJob(j, buf)
+	}
+}
+
+/*
+ * Copy, link, scale or turn the file of a single job and record the result
+ * a panic, e.g. while decoding a malformed image, is counted as a failure of the file
+ * @param buf copy buffer of the worker
+ */
+func (o *organizer) copyJob(j job, buf []byte) {
+	defer o.recoverFile(j.in, slog.String("source", j.from), slog.String("destination", j.to))
+	if o.cfg.Commands != nil {
+		o.printCommands(j)
+		return
+	}
+	if o.cfg.MinFree > 0 && !o.roomFor(j) {
+		o.mu.Lock()
+		o.dropped++
+		o.mu.Unlock()
+		return
+	}
+	o.logf(LOG_INFO, "\"%s\",\"%s\"", slog.String("source", j.from), slog.String("destination", j.to))
+	var thumb bool = o.cfg.ThumbWidth > 0 && o.cfg.ThumbHeight > 0 // write a thumbnail instead of a copy
+	var orientation int = 1                                        // EXIF orientation of the source
+	if o.cfg.AutoRotate {
+		orientation, _ = exifOrientation(j.from) // not a JPEG or no EXIF, copy as it is
+	}
+	var rotate bool = orientation > 1 && !j.convert                          // turn the photo upright, a converted one is turned while at it
+	var h hash.Hash                                                          // hash content while copying if the manifest needs it
+	if o.manifest != nil && (j.hash == "" || thumb || rotate || j.convert) { // a thumbnail, turned or converted photo differs from the source
+		h = sha256.New()
+	}
+	var written int64 // bytes copied
+	var err error
+	var isLink bool = false                                // hard link created instead of a copy
+	var tryLink bool = o.cfg.Link && !rotate && !j.convert // a turned or converted photo can't share the content of its source
+	if tryLink {
+		written, err = link(j.from, j.to, h)
+		isLink = err == nil
+		if isCrossDevice(err) { // input and output are on different devices
+			o.logf(LOG_ERROR, "can't link %s across devices, copy instead", slog.String("source", j.from))
+		}
+	}
+	if thumb {
+		written, err = thumbFile(o.ctx, j.from, j.to, o.cfg.ThumbWidth, o.cfg.ThumbHeight, orientation, j.modTime, j.mode, h)
+		if errors.Is(err, errNoThumb) { // e.g. a BMP, take it as it is
+			o.logf(LOG_ERROR, "%s, copy instead", slog.Any("error", err), slog.String("source", j.from))
+			thumb, rotate = false, false
+		}
+	} else if j.convert {
+		written, err = convertFile(o.ctx, j.from, j.to, o.cfg.Convert, o.cfg.Quality, orientation, j.modTime, j.mode, h)
+		if errors.Is(err, errNoConvert) { // broken image data, take it as it is
+			o.logf(LOG_ERROR, "%s, copy instead", slog.Any("error", err), slog.String("source", j.from))
+			o.mu.Lock()
+			o.res.NoConvert++ // record this incident
+			o.mu.Unlock()
+			j.convert = false
+		}
+	} else if rotate {
+		written, err = rotateFile(o.ctx, j.from, j.to, orientation, o.cfg.Quality, j.modTime, j.mode, h)
+		if errors.Is(err, errNoRotate) { // broken image data, take it as it is
+			o.logf(LOG_ERROR, "%s, copy instead", slog.Any("error", err), slog.String("source", j.from))
+			rotate = false
+		}
+	}
+	if (!tryLink && !thumb && !rotate && !j.convert) || isCrossDevice(err) {
+		written, err = o.copyRetry(j, h, buf) // copy
+	}
+	if errors.Is(err, ErrCanceled) { // canceled, the partial copy is already removed
+		o.mu.Lock()
+		o.dropped++
+		o.mu.Unlock()
+		return
+	}
+	if err != nil { // if we encounter an error in copy process
+		o.fail(j.in, err, slog.String("source", j.from), slog.String("destination", j.to))
+		o.forget(j)
+		return
+	}
+	// read both files again and make sure they're identical
+	if o.cfg.Verify && !isLink && !thumb && !rotate && !j.convert {
+		err = verify(j.from, j.to)
+		if err != nil {
+			os.Remove(j.to) // don't leave a bad copy behind
+			o.forget(j)
+			o.mu.Lock()
+			o.res.Failed++ // record this incident
+			o.res.VerifyError++
+			o.res.FailedIn[j.in]++
+			o.mu.Unlock()
+			o.logf(LOG_ERROR, "%s", slog.Any("error", err), slog.String("source", j.from), slog.String("destination", j.to))
+			return
+		}
+	}
+	// carry over extended attributes, a hard link shares them already
+	if o.cfg.Xattrs && !isLink {
+		err = copyXattrs(j.from, j.to)
+		if errors.Is(err, errors.ErrUnsupported) { // the copy is fine, only without attributes
+			o.xattrWarn.Do(func() {
+				o.logf(LOG_QUIET, "%s, copies are made without extended attributes", slog.Any("error", err))
+			})
+		} else if err != nil {
+			o.mu.Lock()
+			o.res.Failed++ // record this incident
+			o.res.XattrError++
+			o.res.FailedIn[j.in]++
+			o.mu.Unlock()
+			o.logf(LOG_ERROR, "%s", slog.Any("error", err), slog.String("source", j.from), slog.String("destination", j.to))
+		}
+	}
+	o.mu.Lock()
+	if isLink {
+		o.res.Linked++ // record how many files were linked
+	} else {
+		o.res.Copied++ // record how many files were copied
+		o.res.BytesCopied += written
+	}
+	o.res.CopiedIn[j.in]++
+	if thumb {
+		o.res.Thumbs++
+	}
+	if rotate {
+		o.res.Rotated++
+	}
+	if j.convert {
+		o.res.Converted++
+	}
+	o.res.CopiedByExt[strings.TrimPrefix(strings.ToLower(filepath.Ext(j.to)), ".")]++
+	if o.manifest != nil && h != nil {
+		j.hash = hex.EncodeToString(h.Sum(nil))
+	}
+	var errState error = o.record(j.from, j.to, written, j.hash, j.info)
+	o.mu.Unlock()
+	o.warnState(errState)
+	o.progress()
+	// bring along edits of the image
+	if o.cfg.Sidecars {
+		o.copySidecars(j, buf)
+	}
+	// remove source only after a successful copy
+	if o.cfg.Move {
+		var err = os.Remove(j.from)
+		o.mu.Lock()
+		if err != nil { // source stays in place, the copy is still valid
+			o.res.Failed++ // record this incident
+			o.res.RemoveError++
+			o.res.FailedIn[j.in]++
+		} else {
+			o.res.Moved++ // record how many files were moved
+			o.movedFrom[filepath.Dir(j.from)] = j.root
+		}
+		o.mu.Unlock()
+		if err != nil {
+			o.logf(LOG_ERROR, "%s", slog.Any("error", err), slog.String("source", j.from))
+		}
+	}
+}
+
+/*
+ * Forget the content of a failed copy for Dedup, so the next file with the same content is copied
+ * instead of skipped as a duplicate of a copy that doesn't exist
+ */
+func (o *organizer) forget(j job) {
+	if !o.cfg.Dedup {
+		return
+	}
+	o.mu.Lock()
+	if o.seen[j.hash] == j.to { // queued by this job, not by another one with the same content
+		delete(o.seen, j.hash)
+	}
+	o.mu.Unlock()
+}
+
+/*
+ * Record a copy in the manifest, state file and the list of Gallery, with mu held
+ * used for images and their sidecars alike, so Undo and the next run know about both
+ * @param hash SHA-256 of the copy, only used by the manifest
+ * @param info source file, only used by the state file
+ * @return error writing the state file, see warnState
+ */
+func (o *organizer) record(from string, to string, written int64, hash string, info os.FileInfo) error {
+	if o.manifest != nil {
+		o.manifest.Write([]string{from, to, strconv.FormatInt(written, 10), hash})
+	}
+	if o.cfg.Gallery {
+		o.copies = append(o.copies, to)
+	}
+	if o.state != nil {
+		return writeState(o.state, from, info)
+	}
+	return nil
+}
+
+/*
+ * Warn once that the state file can't be written, the copy is fine, only the next run will copy it again
+ */
+func (o *organizer) warnState(err error) {
+	if err != nil {
+		o.stateWarn.Do(func() {
+			o.logf(LOG_ERROR, "%s, copies are no longer recorded in %s", slog.Any("error", err), slog.String("state", o.cfg.State))
+		})
+	}
+}
+
+/*
+ * Copy a job's file, retrying up to Retries times with a doubling backoff if the error looks transient
+ * @param h reset before each retry, so it only covers the content of the final copy
+ */
+func (o *organizer) copyRetry(j job, h hash.Hash, buf []byte) (int64, error) {
+	var wait time.Duration = 100 * time.Millisecond
+	var wrap func(io.Reader) io.Reader
+	if o.cfg.Progress != nil && j.info != nil && j.info.Size() >= LargeFileSize {
+		wrap = o.track(j.from, j.info.Size())
+		defer o.untrack(j.from)
+	}
+	for attempt := 0; ; attempt++ {
+		written, err := copyFile(o.ctx, j.from, j.to, j.modTime, j.mode, h, buf, o.limiter, wrap)
+		if err == nil && attempt > 0 {
+			o.mu.Lock()
+			o.res.Retried++ // record this incident
+			o.mu.Unlock()
+		}
+		if err == nil || attempt >= o.cfg.Retries || !isTransient(err) {
+			return written, err
+		}
+		o.logf(LOG_ERROR, "%s, retry in %s", slog.Any("error", err), slog.Duration("wait", wait), slog.String("source", j.from))
+		select {
+		case <-o.ctx.Done():
+			return 0, ErrCanceled
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if h != nil {
+			h.Reset()
+		}
+	}
+}
+
+/*
+ * Report the copy of a large file to Config.Progress while it's going on, until untrack
+ * @return wraps the source reader of copyFile, counting bytes read, Progress is called whenever another percent is done
+ */
+func (o *organizer) track(from string, size int64) func(io.Reader) io.Reader {
+	var f = &FileProgress{Source: from, Size: size}
+	o.mu.Lock()
+	o.copying = append(o.copying, f)
+	o.mu.Unlock()
+	return func(r io.Reader) io.Reader {
+		o.mu.Lock()
+		f.Copied = 0 // a retry starts over
+		o.mu.Unlock()
+		return progressReader{r, func(n int) {
+			o.mu.Lock()
+			var before int64 = f.Copied * 100 / f.Size
+			f.Copied += int64(n)
+			var percent int64 = f.Copied * 100 / f.Size
+			o.mu.Unlock()
+			if percent != before {
+				o.progress()
+			}
+		}}
+	}
+}
+
+/*
+ * Stop reporting the copy of a large file, once it's done or failed
+ */
+func (o *organizer) untrack(from string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, f := range o.copying {
+		if f.Source == from {
+			o.copying = append(o.copying[:i], o.copying[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+ * Log a message of the run
+ * @see logf()
+ */
+func (o *organizer) logf(level int, format string, attrs ...slog.Attr) {
+	logf(o.cfg, level, format, attrs...)
+}
+
+// guards writes to Config.ErrLog
+var errLogMu sync.Mutex
+
+/*
+ * Log a message if cfg.LogLevel includes level
+ * the message is format filled in with the values of attrs, errors go to cfg.Stderr and
+ * everything else to cfg.Stdout, or everything to cfg.Logger together with attrs,
+ * errors go to cfg.ErrLog as well whatever the level
+ * @param attrs one for each verb in format, e.g. slog.String("source", path), any further ones only go to Logger
+ */
+func logf(cfg Config, level int, format string, attrs ...slog.Attr) {
+	var errLog bool = level == LOG_ERROR && cfg.ErrLog != nil
+	if cfg.LogLevel < level && !errLog {
+		return
+	}
+	var args []interface{}
+	for _, attr := range attrs[:min(len(attrs), strings.Count(format, "%")-2*strings.Count(format, "%%"))] {
+		args = append(args, attr.Value.Any())
+	}
+	var msg string = fmt.Sprintf(format, args...)
+	if errLog { // one line per record, workers log concurrently
+		errLogMu.Lock()
+		slog.New(slog.NewTextHandler(cfg.ErrLog, nil)).LogAttrs(context.Background(), slog.LevelError, msg, attrs...)
+		errLogMu.Unlock()
+	}
+	if cfg.LogLevel < level {
+		return
+	}
+	if cfg.Logger != nil {
+		var l slog.Level = slog.LevelInfo // LOG_QUIET, e.g. files listed by Plan
+		switch level {
+		case LOG_ERROR:
+			l = slog.LevelError
+		case LOG_DEBUG:
+			l = slog.LevelDebug
+		}
+		cfg.Logger.LogAttrs(context.Background(), l, msg, attrs...)
+		return
+	}
+	if level <= LOG_ERROR {
+		fmt.Fprintln(cfg.Stderr, msg)
+	} else {
+		fmt.Fprintln(cfg.Stdout, msg)
+	}
+}
+
+/*
+ * Find a free destination path, used by every naming mode that keeps or builds names
+ * try "foo.jpg" first, then "foo-1.jpg", "foo-2.jpg" ... until nothing exists on disk
+ * and the path hasn't been handed out to a queued job
+ * paths are reserved case-insensitively, as "Foo.jpg" and "foo.jpg" are the same file
+ * on Windows and macOS
+ * note: sequential IDs don't go through here, they're unique within a run and an existing
+ *       file is skipped instead unless Force is set; a "1.jpg" left by an earlier run is
+ *       treated like any other existing file and a kept name "1.jpg" becomes "1-1.jpg"
+ * safe for concurrent use
+ */
+func (o *organizer) uniqueDest(path string) string {
+	o.reservedMu.Lock()
+	defer o.reservedMu.Unlock()
+	return o.numberDest(path, "")
+}
+
+/*
+ * Find a free destination path for uniqueDest, with reservedMu held
+ * @param hash content hash of the source recorded with the reservation, see organizer.reserved
+ */
+func (o *organizer) numberDest(path string, hash string) string {
+	var ext string = filepath.Ext(path)
+	var base string = strings.TrimSuffix(path, ext)
+	var dest string = path
+	for n := 1; ; n++ {
+		var key string = strings.ToLower(dest)
+		// any error but "exists" counts as free, the copy reports e.g. a name that is too long
+		if _, reserved := o.reserved[key]; !reserved {
+			if _, err := os.Lstat(dest); err != nil { // free name
+				o.reserved[key] = hash
+				return dest
+			}
+		}
+		dest = base + "-" + strconv.Itoa(n) + ext
+	}
+}
+
+/*
+ * Find a destination path for Collision "hash"
+ * try "foo.jpg" first, then "foo-a1b2c3d4.jpg" after the content hash, a path taken by the
+ * same content, in this run or on disk, is returned as a duplicate instead
+ * if both are taken by other content, e.g. an unrelated file, numbers are appended like
+ * uniqueDest does, "foo-a1b2c3d4-1.jpg"
+ * note: files on disk are compared by their own content, so a turned, converted or
+ *       thumbnail copy of an earlier run doesn't count as the same
+ * safe for concurrent use
+ * @return path and whether the same content is there already
+ */
+func (o *organizer) hashDest(path string, hash string) (string, bool) {
+	o.reservedMu.Lock()
+	defer o.reservedMu.Unlock()
+	var hashed string = strings.TrimSuffix(path, filepath.Ext(path)) + "-" + hash[:collisionHashLen] + filepath.Ext(path)
+	for _, dest := range []string{path, hashed} {
+		occupant, reserved := o.reserved[strings.ToLower(dest)]
+		if !reserved {
+			if _, err := os.Lstat(dest); err != nil { // free name
+				o.reserved[strings.ToLower(dest)] = hash
+				return dest, false
+			}
+			occupant, _ = hashFile(dest) // can't be read, count it as other content
+		}
+		if occupant == hash {
+			return dest, true
+		}
+	}
+	return o.numberDest(hashed, hash), false
+}
@@ -0,0 +1,591 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of the search and copy with temporary directory fixtures
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+/*
+ * Create files under root, each holding its own name, with the directories they're in
+ * @param files slash-separated paths relative to root
+ */
+func writeTree(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		var path string = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+/*
+ * List the files under root
+ * @return slash-separated paths relative to root, sorted
+ */
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+	var files = []string{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+/*
+ * Run Organize with messages discarded, failing the test if it returns an error
+ */
+func organize(t *testing.T, cfg Config) Result {
+	t.Helper()
+	cfg.Stdout, cfg.Stderr = io.Discard, io.Discard
+	res, err := Organize(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// fixture of TestOrganize, files of several extensions at several depths
+var treeFiles = []string{
+	"a.jpg", "b.PNG", "c.txt", ".hidden.jpg", "Thumbs.db",
+	"d1/e.jpg", "d1/notes.txt",
+	"d1/d2/f.jpeg",
+	"d1/d2/d3/g.jpg",
+	"raw/h.jpg",
+}
+
+func TestOrganize(t *testing.T) {
+	var tests = []struct {
+		name   string
+		cfg    Config
+		found  int
+		copied int
+		out    []string // files in Out afterwards
+	}{
+		{"all", Config{Depth: 10}, 6, 6, []string{"1.jpg", "2.png", "3.jpg", "4.jpeg", "5.jpg", "6.jpg"}}, // WalkDir goes by name, d1/d2/d3/g.jpg before d1/d2/f.jpeg
+		{"unlimited depth", Config{Depth: 0}, 6, 6, []string{"1.jpg", "2.png", "3.jpg", "4.jpeg", "5.jpg", "6.jpg"}},
+		{"depth 1", Config{Depth: 1}, 4, 4, []string{"1.jpg", "2.png", "3.jpg", "4.jpg"}},
+		{"depth 2", Config{Depth: 2}, 5, 5, []string{"1.jpg", "2.png", "3.jpeg", "4.jpg", "5.jpg"}},
+		{"scan-only", Config{Depth: 10, ScanOnly: true}, 6, 0, []string{}},
+		{"extension filter", Config{Depth: 10, Ext: []string{"jpeg", "png"}}, 2, 2, []string{"1.png", "2.jpeg"}},
+		{"excluded extension", Config{Depth: 10, Exclude: []string{"jpg"}}, 2, 2, []string{"1.png", "2.jpeg"}},
+		{"skip list", Config{Depth: 10, SystemFiles: []string{"RAW", "d2"}}, 3, 3, []string{"1.jpg", "2.png", "3.jpg"}},
+		{"hidden", Config{Depth: 1, Hidden: true}, 5, 5, []string{"1.jpg", "2.jpg", "3.png", "4.jpg", "5.jpg"}},
+		{"keep names", Config{Depth: 1, Keep: true}, 4, 4, []string{"a.jpg", "b.png", "e.jpg", "h.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in, out string = t.TempDir(), t.TempDir()
+			writeTree(t, in, treeFiles...)
+			var cfg Config = tt.cfg
+			cfg.In, cfg.Out = []string{in}, out
+			if cfg.Ext == nil {
+				cfg.Ext = []string{"jpg", "jpeg", "png"}
+			}
+			res := organize(t, cfg)
+			if res.Found != tt.found || res.Copied != tt.copied || res.Failed != 0 {
+				t.Errorf("found %d, copied %d, failed %d, want %d, %d, 0", res.Found, res.Copied, res.Failed, tt.found, tt.copied)
+			}
+			if got := listTree(t, out); !reflect.DeepEqual(got, tt.out) {
+				t.Errorf("output %v, want %v", got, tt.out)
+			}
+		})
+	}
+}
+
+func TestOrganizeDepthLimit(t *testing.T) {
+	var in string = t.TempDir()
+	writeTree(t, in, treeFiles...)
+	res := organize(t, Config{In: []string{in}, Out: t.TempDir(), Ext: []string{"jpg"}, Depth: 2, ScanOnly: true})
+	if res.DepthLimitReached != 1 { // d1/d2/d3 only
+		t.Errorf("depth limit reached %d times, want 1", res.DepthLimitReached)
+	}
+	res = organize(t, Config{In: []string{in}, Out: t.TempDir(), Ext: []string{"jpg"}, Depth: 0, ScanOnly: true})
+	if res.DepthLimitReached != 0 {
+		t.Errorf("depth limit reached %d times without a limit", res.DepthLimitReached)
+	}
+}
+
+func TestOrganizeSkipCounts(t *testing.T) {
+	var in string = t.TempDir()
+	writeTree(t, in, treeFiles...)
+	res := organize(t, Config{In: []string{in}, Out: t.TempDir(), Ext: []string{"jpg"}, Depth: 10, ScanOnly: true, SystemFiles: []string{"raw"}})
+	if res.Hidden != 1 || res.SystemFiles != 2 { // .hidden.jpg, Thumbs.db and raw/
+		t.Errorf("hidden %d, system files %d, want 1 and 2", res.Hidden, res.SystemFiles)
+	}
+}
+
+func TestUniqueDestinations(t *testing.T) {
+	// many workers copying files of the same name, each has to get a destination of its own,
+	// sequential IDs are handed out once each, run with -race
+	const dirs = 200
+	var in string = t.TempDir()
+	for i := 0; i < dirs; i++ {
+		writeTree(t, in, fmt.Sprintf("%03d/IMG_1.jpg", i), fmt.Sprintf("%03d/more/IMG_1.JPG", i)) // not in the same directory on case-insensitive filesystems
+	}
+	for _, tt := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"sequential", Config{}},
+		{"kept names", Config{Keep: true}},
+		{"id per extension", Config{IDPerExt: true, Name: "photo"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out string = t.TempDir()
+			var manifest bytes.Buffer
+			var cfg Config = tt.cfg
+			cfg.In, cfg.Out, cfg.Ext, cfg.Depth, cfg.Jobs, cfg.Manifest = []string{in}, out, []string{"jpg"}, 3, 16, &manifest
+			res := organize(t, cfg)
+			if res.Copied != 2*dirs || res.Skipped != 0 || res.Failed != 0 {
+				t.Fatalf("copied %d, skipped %d, failed %d, want %d, 0, 0", res.Copied, res.Skipped, res.Failed, 2*dirs)
+			}
+			if files := listTree(t, out); len(files) != 2*dirs {
+				t.Errorf("%d files in output, want %d", len(files), 2*dirs)
+			}
+			r, err := readManifest(&manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var dests = make(map[string]string) // lowercase destination to source
+			for _, record := range records {
+				var key string = strings.ToLower(record[1])
+				if from, ok := dests[key]; ok {
+					t.Errorf("%s and %s both copied to %s", from, record[0], record[1])
+				}
+				dests[key] = record[0]
+			}
+			if len(dests) != 2*dirs {
+				t.Errorf("%d destinations in manifest, want %d", len(dests), 2*dirs)
+			}
+			if !tt.cfg.Keep { // every ID from 1 up exactly once
+				for id := 1; id <= 2*dirs; id++ {
+					var name string = strconv.Itoa(id) + ".jpg"
+					if tt.cfg.Name != "" {
+						name = tt.cfg.Name + "_" + name
+					}
+					if _, ok := dests[strings.ToLower(filepath.Join(out, name))]; !ok {
+						t.Errorf("ID %d not used", id)
+					}
+				}
+				if res.LastID != 2*dirs {
+					t.Errorf("last ID %d, want %d", res.LastID, 2*dirs)
+				}
+			}
+		})
+	}
+}
+
+func TestUniqueDestConcurrent(t *testing.T) {
+	// two or more jobs after the same name each get one of their own, run with -race
+	var path string = filepath.Join(t.TempDir(), "IMG_1.jpg")
+	var o = &organizer{reserved: make(map[string]string)}
+	var dests = make(chan string, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(dests); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dests <- o.uniqueDest(path)
+		}()
+	}
+	wg.Wait()
+	close(dests)
+	var seen = make(map[string]bool)
+	for dest := range dests {
+		if seen[dest] {
+			t.Errorf("%s handed out twice", dest)
+		}
+		seen[dest] = true
+	}
+	if len(seen) != cap(dests) || !seen[path] {
+		t.Errorf("%d destinations, want %d including %s", len(seen), cap(dests), path)
+	}
+}
+
+func TestNewestWithoutTimes(t *testing.T) {
+	// Newest compares modification times, which have to be loaded even if NoTime, NoPerm and AllowEmpty need none
+	var in, out string = t.TempDir(), t.TempDir()
+	writeTree(t, in, "a/IMG_1.jpg", "b/IMG_1.jpg", "c/IMG_1.jpg", "c/IMG_2.jpg")
+	for i, name := range []string{"a/IMG_1.jpg", "c/IMG_1.jpg", "b/IMG_1.jpg"} { // oldest first
+		var modTime time.Time = time.Date(2019, 1, 2+i, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(filepath.Join(in, filepath.FromSlash(name)), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"jpg"}, Depth: 10, Jobs: 4,
+		Keep: true, Newest: true, NoTime: true, NoPerm: true, AllowEmpty: true})
+	if res.Panics != 0 || res.Failed != 0 {
+		t.Fatalf("%d panics, %d failed", res.Panics, res.Failed)
+	}
+	if res.Copied != 2 || res.Outdated != 2 {
+		t.Errorf("copied %d, outdated %d, want 2 and 2", res.Copied, res.Outdated)
+	}
+	if got, want := listTree(t, out), []string{"IMG_1.jpg", "IMG_2.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output %v, want %v", got, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(out, "IMG_1.jpg")); string(data) != "b/IMG_1.jpg" {
+		t.Errorf("IMG_1.jpg is a copy of %s, want the newest b/IMG_1.jpg", data)
+	}
+}
+
+func TestOutputUnderInput(t *testing.T) {
+	var in string = t.TempDir()
+	writeTree(t, in, "a.jpg", "d1/b.jpg")
+	var out string = filepath.Join(in, "d1", "out")
+	if err := os.Mkdir(out, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var link string = filepath.Join(t.TempDir(), "out") // the same directory by another path
+	if err := os.Symlink(out, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	for i, to := range []string{out, link, out} { // later runs find the copies of earlier ones in the tree
+		res := organize(t, Config{In: []string{in}, Out: to, Ext: []string{"jpg"}, Depth: 10, Keep: true, Collision: "hash"})
+		if res.Found != 2 || res.Failed != 0 {
+			t.Errorf("run %d: found %d, failed %d, want 2 and 0", i+1, res.Found, res.Failed)
+		}
+		if got, want := listTree(t, out), []string{"a.jpg", "b.jpg"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("run %d: output %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestUniqueDest(t *testing.T) {
+	var dir string = t.TempDir()
+	var path string = filepath.Join(dir, "IMG_1.jpg")
+	var tests = []struct {
+		name     string
+		existing []string // files on disk
+		reserved []string // destinations handed out to queued jobs
+		want     string
+	}{
+		{"free", nil, nil, "IMG_1.jpg"},
+		{"exists", []string{"IMG_1.jpg"}, nil, "IMG_1-1.jpg"},
+		{"numbered exists", []string{"IMG_1.jpg", "IMG_1-1.jpg"}, nil, "IMG_1-2.jpg"},
+		{"gap", []string{"IMG_1.jpg", "IMG_1-2.jpg"}, nil, "IMG_1-1.jpg"},
+		{"reserved", nil, []string{"IMG_1.jpg"}, "IMG_1-1.jpg"},
+		{"reserved in other case", nil, []string{"img_1.JPG"}, "IMG_1-1.jpg"},
+		{"exists and reserved", []string{"IMG_1.jpg"}, []string{"IMG_1-1.jpg"}, "IMG_1-2.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dir string = t.TempDir()
+			writeTree(t, dir, tt.existing...)
+			var o = &organizer{reserved: make(map[string]string)}
+			for _, name := range tt.reserved {
+				o.reserved[strings.ToLower(filepath.Join(dir, name))] = ""
+			}
+			if got := o.uniqueDest(filepath.Join(dir, "IMG_1.jpg")); got != filepath.Join(dir, tt.want) {
+				t.Errorf("got %s, want %s", filepath.Base(got), tt.want)
+			}
+		})
+	}
+
+	// repeated collisions, each call reserves what it hands out
+	var o = &organizer{reserved: make(map[string]string)}
+	writeTree(t, dir, "IMG_1.jpg")
+	for _, want := range []string{"IMG_1-1.jpg", "IMG_1-2.jpg", "IMG_1-3.jpg"} {
+		if got := o.uniqueDest(path); got != filepath.Join(dir, want) {
+			t.Errorf("got %s, want %s", filepath.Base(got), want)
+		}
+	}
+}
+
+func TestHashDest(t *testing.T) {
+	var dir string = t.TempDir()
+	writeTree(t, dir, "IMG_1.jpg") // content "IMG_1.jpg"
+	onDisk, err := hashFile(filepath.Join(dir, "IMG_1.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var other, third string = strings.Repeat("a", 64), strings.Repeat("b", 64)
+	var o = &organizer{reserved: make(map[string]string)}
+	var tests = []struct {
+		name string
+		hash string
+		want string
+		dup  bool
+	}{
+		{"same as on disk", onDisk, "IMG_1.jpg", true},
+		{"other content", other, "IMG_1-aaaaaaaa.jpg", false},
+		{"same as reserved", other, "IMG_1-aaaaaaaa.jpg", true},
+		{"third content", third, "IMG_1-bbbbbbbb.jpg", false},
+	}
+	for _, tt := range tests {
+		got, dup := o.hashDest(filepath.Join(dir, "IMG_1.jpg"), tt.hash)
+		if got != filepath.Join(dir, tt.want) || dup != tt.dup {
+			t.Errorf("%s: got %s, %v, want %s, %v", tt.name, filepath.Base(got), dup, tt.want, tt.dup)
+		}
+	}
+	// both names taken by other content, numbered after the hashed one
+	writeTree(t, dir, "IMG_2.jpg", "IMG_2-cccccccc.jpg")
+	if got, dup := o.hashDest(filepath.Join(dir, "IMG_2.jpg"), strings.Repeat("c", 64)); got != filepath.Join(dir, "IMG_2-cccccccc-1.jpg") || dup {
+		t.Errorf("got %s, %v, want IMG_2-cccccccc-1.jpg, false", filepath.Base(got), dup)
+	}
+}
+
+func TestOrganizeFS(t *testing.T) {
+	// the walk and its filters on an in-memory filesystem, nothing is read from disk
+	var old time.Time = time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	var fsys = fstest.MapFS{
+		"in/a.jpg":              {Data: []byte("aaaa")},
+		"in/b.PNG":              {Data: []byte("bbbbbbbb")},
+		"in/c.txt":              {Data: []byte("c")},
+		"in/tiny.jpg":           {Data: []byte("t")},
+		"in/empty.jpg":          {},
+		"in/old.jpg":            {Data: []byte("oooo"), ModTime: old},
+		"in/.hidden.jpg":        {Data: []byte("hhhh")},
+		"in/.DS_Store":          {Data: []byte("x")},
+		"in/.imoignore":         {Data: []byte("cache/\n*.thumb.jpg\n")},
+		"in/x.thumb.jpg":        {Data: []byte("xxxx")},
+		"in/cache/d.jpg":        {Data: []byte("dddd")},
+		"in/d1/e.jpg":           {Data: []byte("eeee")},
+		"in/d1/d2/f.jpg":        {Data: []byte("ffff")},
+		"in/d1/d2/d3/g.jpg":     {Data: []byte("gggg")},
+		"in/Thumbs.db":          {Data: []byte("x")},
+		"in/$RECYCLE.BIN/h.jpg": {Data: []byte("hhhh")},
+		"other/i.jpg":           {Data: []byte("iiii")},
+	}
+	var tests = []struct {
+		name  string
+		cfg   Config
+		found int
+		bytes int64
+		check func(t *testing.T, res Result)
+	}{
+		{"all", Config{Depth: 10}, 7, 29, func(t *testing.T, res Result) {
+			if res.Hidden != 1 || res.SystemFiles != 3 || res.Ignored != 2 || res.EmptyFiles != 1 {
+				t.Errorf("hidden %d, system files %d, ignored %d, empty %d, want 1, 3, 2, 1", res.Hidden, res.SystemFiles, res.Ignored, res.EmptyFiles)
+			}
+		}},
+		{"depth", Config{Depth: 2}, 6, 25, func(t *testing.T, res Result) {
+			if res.DepthLimitReached != 1 {
+				t.Errorf("depth limit reached %d times, want 1", res.DepthLimitReached)
+			}
+		}},
+		{"no recursion", Config{Depth: 10, NoRecurse: true}, 4, 17, nil},
+		{"extension", Config{Depth: 10, Ext: []string{"png"}}, 1, 8, nil},
+		{"minimum size", Config{Depth: 10, MinSize: 2}, 6, 28, func(t *testing.T, res Result) {
+			if res.TooSmall != 1 {
+				t.Errorf("too small %d, want 1", res.TooSmall)
+			}
+		}},
+		{"until", Config{Depth: 10, Until: old.Add(-time.Hour)}, 6, 25, func(t *testing.T, res Result) { // the others have no time, they're older
+			if res.OutOfRange != 1 {
+				t.Errorf("out of range %d, want 1", res.OutOfRange)
+			}
+		}},
+		{"match", Config{Depth: 10, Match: regexp.MustCompile(`^[a-c]\.`)}, 2, 12, nil},
+		{"hidden", Config{Depth: 1, Hidden: true}, 6, 25, nil},
+		{"two inputs", Config{Depth: 10, In: []string{"in", "other"}}, 8, 33, func(t *testing.T, res Result) {
+			if !reflect.DeepEqual(res.FoundIn, []int{7, 1}) {
+				t.Errorf("found per input %v, want [7 1]", res.FoundIn)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config = tt.cfg
+			cfg.FS, cfg.ScanOnly = fsys, true
+			if cfg.In == nil {
+				cfg.In = []string{"in"}
+			}
+			if cfg.Ext == nil {
+				cfg.Ext = []string{"jpg", "png"}
+			}
+			res := organize(t, cfg)
+			if res.Found != tt.found || res.BytesFound != tt.bytes || res.Failed != 0 {
+				t.Errorf("found %d of %d bytes, failed %d, want %d of %d bytes, 0", res.Found, res.BytesFound, res.Failed, tt.found, tt.bytes)
+			}
+			if tt.check != nil {
+				tt.check(t, res)
+			}
+		})
+	}
+}
+
+func TestOrganizeFSInvalid(t *testing.T) {
+	var fsys = fstest.MapFS{"in/a.jpg": {Data: []byte("a")}}
+	for _, cfg := range []Config{
+		{In: []string{"in"}, Ext: []string{"jpg"}, FS: fsys},                                       // copies
+		{In: []string{"in"}, Ext: []string{"jpg"}, FS: fsys, ScanOnly: true, Sniff: true},          // reads content
+		{In: []string{"../in"}, Ext: []string{"jpg"}, FS: fsys, ScanOnly: true},                    // outside FS
+		{In: []string{"in"}, Ext: []string{"jpg"}, FS: fsys, ScanOnly: true, Manifest: io.Discard}, // needs real paths
+	} {
+		cfg.Stdout, cfg.Stderr = io.Discard, io.Discard
+		if _, err := Organize(context.Background(), cfg); err == nil {
+			t.Errorf("no error for %+v", cfg)
+		}
+	}
+}
+
+/*
+ * Build an in-memory tree of dirs directories with files each, a mix of images and other files
+ */
+func benchFS(dirs int, files int) fstest.MapFS {
+	var fsys = fstest.MapFS{}
+	for d := 0; d < dirs; d++ {
+		for f := 0; f < files; f++ {
+			var ext string = []string{"jpg", "png", "txt", "JPG"}[f%4]
+			fsys[fmt.Sprintf("in/%02d/%02d/IMG_%04d.%s", d/10, d%10, f, ext)] = &fstest.MapFile{Data: []byte("data")}
+		}
+	}
+	return fsys
+}
+
+func BenchmarkOrganize(b *testing.B) {
+	// traversal overhead of the walk and its filters without any disk I/O
+	for _, bm := range []struct {
+		name  string
+		dirs  int
+		files int
+		cfg   Config
+	}{
+		{"flat", 1, 10000, Config{}},
+		{"tree", 100, 100, Config{}},
+		{"sorted by size", 100, 100, Config{Sort: "size"}},
+		{"stats", 100, 100, Config{Stats: true}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			var cfg Config = bm.cfg
+			cfg.FS, cfg.In, cfg.Ext, cfg.Depth, cfg.ScanOnly = benchFS(bm.dirs, bm.files), []string{"in"}, []string{"jpg", "png"}, 0, true
+			cfg.Stdout, cfg.Stderr = io.Discard, io.Discard
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				res, err := Organize(context.Background(), cfg)
+				if err != nil || (res.Found != bm.dirs*bm.files*3/4 && !cfg.Stats) {
+					b.Fatalf("found %d, %v", res.Found, err)
+				}
+			}
+			b.ReportMetric(float64(bm.dirs*bm.files)*float64(b.N)/b.Elapsed().Seconds(), "files/s")
+		})
+	}
+}
+
+func TestDefaultSystemFiles(t *testing.T) {
+	// every default is skipped as a file, e.g. Thumbs.db, and as a directory, e.g. $RECYCLE.BIN,
+	// even with Hidden and extensions that would take it
+	for _, asDir := range []bool{false, true} {
+		var in string = t.TempDir()
+		writeTree(t, in, "a.jpg")
+		for _, name := range DefaultSystemFiles {
+			if asDir {
+				name += "/b.jpg"
+			}
+			writeTree(t, in, name)
+		}
+		res := organize(t, Config{In: []string{in}, Out: t.TempDir(), Ext: []string{"jpg", "db", "ini", "ds_store"}, Depth: 10, ScanOnly: true, Hidden: true})
+		if res.Found != 1 {
+			t.Errorf("directories %v: found %d, want only a.jpg", asDir, res.Found)
+		}
+		if res.SystemFiles != len(DefaultSystemFiles) {
+			t.Errorf("directories %v: %d system files skipped, want %d", asDir, res.SystemFiles, len(DefaultSystemFiles))
+		}
+	}
+
+	// names in other case and further ones of Config.SystemFiles
+	var in string = t.TempDir()
+	writeTree(t, in, "a.jpg", "THUMBS.DB", "desktop.INI/c.jpg", "Proxies/d.jpg", "e.lrprev.jpg")
+	res := organize(t, Config{In: []string{in}, Out: t.TempDir(), Ext: []string{"jpg", "db"}, Depth: 10, ScanOnly: true, SystemFiles: []string{"proxies", "E.LRPREV.JPG"}})
+	if res.Found != 1 || res.SystemFiles != 4 {
+		t.Errorf("found %d, %d system files, want 1 and 4", res.Found, res.SystemFiles)
+	}
+}
+
+func TestIrregularFiles(t *testing.T) {
+	// named pipes, sockets and devices are skipped, counted when they have a name of Ext
+	var fsys = fstest.MapFS{
+		"in/a.jpg":      {Data: []byte("aaaa")},
+		"in/pipe.jpg":   {Mode: fs.ModeNamedPipe},
+		"in/socket.jpg": {Mode: fs.ModeSocket},
+		"in/disk.jpg":   {Mode: fs.ModeDevice},
+		"in/tty.JPG":    {Mode: fs.ModeDevice | fs.ModeCharDevice},
+		"in/pipe.txt":   {Mode: fs.ModeNamedPipe},
+		"in/d/link.jpg": {Mode: fs.ModeSymlink, Data: []byte("../a.jpg")},
+	}
+	res := organize(t, Config{In: []string{"in"}, Ext: []string{"jpg"}, Depth: 10, FS: fsys, ScanOnly: true})
+	if res.Found != 1 || res.BytesFound != 4 || res.Failed != 0 {
+		t.Errorf("found %d of %d bytes, failed %d, want 1 of 4 bytes, 0", res.Found, res.BytesFound, res.Failed)
+	}
+	if res.Irregular != 5 {
+		t.Errorf("%d irregular files skipped, want 5", res.Irregular)
+	}
+}
+
+func TestDescribeType(t *testing.T) {
+	for mode, want := range map[fs.FileMode]string{
+		fs.ModeNamedPipe:                  "named pipe",
+		fs.ModeSocket:                     "socket",
+		fs.ModeDevice:                     "device",
+		fs.ModeDevice | fs.ModeCharDevice: "character device",
+		fs.ModeSymlink:                    "symlink",
+		fs.ModeIrregular:                  "irregular file",
+	} {
+		if got := describeType(mode); got != want {
+			t.Errorf("describeType(%v) = %q, want %q", mode, got, want)
+		}
+	}
+}
+
+func TestDedupFailedCopy(t *testing.T) {
+	// the first copy of a content fails, a later file with it is copied instead of skipped as a duplicate,
+	// those found while the copy was still queued are skipped, so there are plenty of them
+	var in, out string = t.TempDir(), t.TempDir()
+	var names = []string{"a/" + strings.Repeat("x", 240) + ".jpg"} // fine as a source, too long with the prefix
+	for i := 0; i < 100; i++ {
+		names = append(names, fmt.Sprintf("b%03d/IMG_1.jpg", i))
+	}
+	for _, name := range names {
+		var path string = filepath.Join(in, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"jpg"}, Depth: 10, Keep: true, Parents: 1, Dedup: true})
+	if res.Failed != 1 || res.Copied != 1 {
+		t.Errorf("failed %d, copied %d, want 1 and 1", res.Failed, res.Copied)
+	}
+	if got := listTree(t, out); len(got) != 1 || !strings.HasSuffix(got[0], "_IMG_1.jpg") {
+		t.Errorf("output %v, want a single copy of a b*/IMG_1.jpg", got)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Read directories ahead in parallel, for filesystems with a high latency per request
+ */
+
+package organizer
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// a directory listing read ahead by prefetchFS
+type prefetch struct {
+	done    chan struct{} // closed once entries and err are set
+	entries []fs.DirEntry
+	err     error
+	reads   int // times handed out by ReadDir
+}
+
+// a directory entry with its file info read ahead, os.DirEntry reads it on every call to Info
+type infoEntry struct {
+	fs.DirEntry
+	info fs.FileInfo
+	err  error
+}
+
+func (e infoEntry) Info() (fs.FileInfo, error) {
+	return e.info, e.err
+}
+
+/*
+ * Filesystem that reads the sub-directories of every directory listed by ReadDir in the background,
+ * so a walk finds them ready when it gets there, e.g. on a network share where each request takes a while
+ * the walk itself still sees directories one after another in the usual order, so IDs don't change
+ * @see newPrefetchFS
+ */
+type prefetchFS struct {
+	fs.FS
+	jobs  chan struct{}                             // one slot per directory read at a time
+	reads int                                       // ReadDir calls per directory the walk makes, a listing is dropped after that
+	want  func(name string, entry fs.DirEntry) bool // whether the walk is going to list a sub-directory
+
+	mu      sync.Mutex
+	dirs    map[string]*prefetch // listings read or being read ahead by name
+	wg      sync.WaitGroup       // running reads
+	stopped bool
+}
+
+/*
+ * Wrap a filesystem to read directories ahead
+ * @param jobs  number of directories read at the same time
+ * @param reads ReadDir calls per directory of the walk, 2 if it lists directories itself before fs.WalkDir does
+ * @param want  reports whether the walk descends into a sub-directory, others aren't read ahead
+ */
+func newPrefetchFS(fsys fs.FS, jobs int, reads int, want func(name string, entry fs.DirEntry) bool) *prefetchFS {
+	return &prefetchFS{FS: fsys, jobs: make(chan struct{}, jobs), reads: reads, want: want, dirs: make(map[string]*prefetch)}
+}
+
+/*
+ * List a directory, read ahead if its parent has been listed before, see fs.ReadDirFS
+ * its sub-directories are read ahead in turn
+ */
+func (p *prefetchFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p.mu.Lock()
+	d, ok := p.dirs[name]
+	if !ok { // not read ahead, e.g. the root
+		d = &prefetch{done: make(chan struct{})}
+		p.dirs[name] = d
+		p.mu.Unlock()
+		d.entries, d.err = fs.ReadDir(p.FS, name)
+		close(d.done)
+	} else {
+		p.mu.Unlock()
+		<-d.done
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d.reads++
+	if d.reads >= p.reads { // won't be asked for again
+		delete(p.dirs, name)
+	}
+	if d.reads == 1 {
+		for _, entry := range d.entries {
+			var sub string = path.Join(name, entry.Name())
+			if _, ok := p.dirs[sub]; ok || p.stopped || !entry.IsDir() || !p.want(sub, entry) {
+				continue
+			}
+			p.dirs[sub] = &prefetch{done: make(chan struct{})}
+			p.wg.Add(1)
+			go p.read(sub, p.dirs[sub])
+		}
+	}
+	return d.entries, d.err
+}
+
+/*
+ * Read a directory ahead, with the file info of its entries
+ */
+func (p *prefetchFS) read(name string, d *prefetch) {
+	defer p.wg.Done()
+	defer close(d.done)
+	p.jobs <- struct{}{}
+	defer func() { <-p.jobs }()
+	p.mu.Lock()
+	var stopped bool = p.stopped
+	p.mu.Unlock()
+	if stopped { // the walk is over
+		d.err = fs.ErrClosed
+		return
+	}
+	d.entries, d.err = fs.ReadDir(p.FS, name)
+	for i, entry := range d.entries {
+		if !entry.IsDir() {
+			info, err := entry.Info()
+			d.entries[i] = infoEntry{entry, info, err}
+		}
+	}
+}
+
+/*
+ * Get file info, see fs.StatFS
+ */
+func (p *prefetchFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(p.FS, name)
+}
+
+/*
+ * Stop reading ahead and wait for reads in progress, once the walk is over
+ */
+func (p *prefetchFS) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,41 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Curated lists of image and video extensions
+ */
+
+package organizer
+
+// extensions of common image formats
+var presetCommon = []string{"jpg", "jpeg", "png", "bmp", "gif", "webp", "tif", "tiff", "heic", "heif"}
+
+// extensions of camera RAW formats: Canon, Nikon, Sony, Adobe, Fujifilm, Olympus, Panasonic, Pentax, Samsung
+var presetRaw = []string{"cr2", "cr3", "nef", "arw", "dng", "raf", "orf", "rw2", "pef", "srw"}
+
+// extensions of common video formats, e.g. home movies on the SD card of a camera or phone
+var presetVideo = []string{"mp4", "mov", "avi", "mkv", "m4v", "3gp"}
+
+// preset name -> extensions, lowercase and without dot
+var Presets = map[string][]string{
+	"common": presetCommon,
+	"raw":    presetRaw,
+	"video":  presetVideo,
+	"all":    append(append([]string{}, presetCommon...), presetRaw...),
+}
+
+/*
+ * Merge extension lists, keeping the order of first appearance and dropping duplicates
+ */
+func MergeExt(lists ...[]string) []string {
+	var merged []string
+	var seen = make(map[string]bool)
+	for _, list := range lists {
+		for _, ext := range list {
+			if !seen[ext] {
+				seen[ext] = true
+				merged = append(merged, ext)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,127 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Turn JPEG photos upright according to their EXIF orientation
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"os"
+	"time"
+)
+
+// returned, wrapped, by rotateFile if the source can't be decoded, it's copied as it is then
+var errNoRotate = errors.New("can't decode photo to turn it")
+
+// JPEG quality used when re-encoding turned photos if none is configured
+const DefaultQuality int = 95
+
+/*
+ * Write a JPEG photo turned according to its EXIF orientation
+ * the photo is re-encoded, the EXIF data of the source is kept with the orientation
+ * reset to 1, so viewers don't turn it a second time
+ * @param orientation EXIF orientation of the source, 2 to 8
+ * @param quality     JPEG quality of the re-encoded photo, 1 to 100
+ * @param modTime     set as access and modification time of the copy, zero value leaves it untouched
+ * @param mode        permission bits of the copy, 0 for 0644
+ * @param h           if not nil, content is written to h as well
+ * @return size of the copy
+ */
+func rotateFile(ctx context.Context, from string, to string, orientation int, quality int, modTime time.Time, mode os.FileMode, h hash.Hash) (int64, error) {
+	from = longPath(from)
+	seg, err := readExifSegment(from)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := parseTiff(seg[6:])
+	if err != nil {
+		return 0, err
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return 0, err
+	}
+	src, err := jpeg.Decode(in)
+	in.Close()
+	if err != nil {
+		return 0, fmt.Errorf("%w %s: %s", errNoRotate, from, err)
+	}
+	if ctx.Err() != nil { // decoding a large photo takes a while
+		return 0, ErrCanceled
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, orient(src, orientation), &jpeg.Options{Quality: quality})
+	if err != nil {
+		return 0, err
+	}
+	// value slices point into seg, so this patches the segment itself
+	var e exifEntry = entries[exifTagOrientation]
+	e.order.PutUint16(e.value, 1)
+
+	return writeAtomic(to, modTime, mode, h, func(w io.Writer) error {
+		// start of image, then the EXIF segment, then everything the encoder wrote after its own start of image
+		var header = []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+		binary.BigEndian.PutUint16(header[4:], uint16(len(seg)+2))
+		for _, b := range [][]byte{header, seg, buf.Bytes()[2:]} {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+ * Apply an EXIF orientation to an image, so it's displayed upright without EXIF
+ * @param orientation 1 to 8 as defined by TIFF, 5 to 8 swap width and height
+ */
+func orient(src image.Image, orientation int) image.Image {
+	var b image.Rectangle = src.Bounds()
+	var w, h int = b.Dx(), b.Dy()
+	// convert once, so pixels can be read from Pix directly
+	var rgba = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	if orientation < 2 || orientation > 8 {
+		return rgba
+	}
+
+	var dw, dh int = w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	var dst = image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int // source pixel shown at x, y
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // upside down and mirrored
+				sx, sy = x, h-1-y
+			case 5: // mirrored and turned left
+				sx, sy = y, x
+			case 6: // turned left, rotate clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored and turned right
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned right, rotate counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], rgba.Pix[rgba.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
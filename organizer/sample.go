@@ -0,0 +1,65 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Pick a random sample of the files found, e.g. for a test dataset
+ */
+
+package organizer
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// a file picked by Sample, taken once the walk is over
+type sampled struct {
+	seq      int         // position among the files found, they're taken in this order
+	from     string      // directory of the file
+	filename string      // name of the file
+	ext      string      // lowercase extension of the copy, see processFile
+	info     os.FileInfo // nil unless an option needs it, see processFile
+	to       string      // output directory
+	root     string      // input directory the file was found in
+	in       int         // index of root in Config.In
+}
+
+/*
+ * Offer a found file to the sample, reservoir sampling, so every file found has the same chance
+ * to be among the Sample files kept, without holding on to more than those
+ * @see https://en.wikipedia.org/wiki/Reservoir_sampling
+ */
+func (o *organizer) pick(s sampled) {
+	o.offered++
+	s.seq = o.offered
+	if len(o.sample) < o.cfg.Sample {
+		o.sample = append(o.sample, s)
+		return
+	}
+	if i := o.rng.Intn(o.offered); i < o.cfg.Sample { // replaces one picked before
+		o.logf(LOG_DEBUG, "drop %s from sample", slog.String("source", filepath.Join(o.sample[i].from, o.sample[i].filename)))
+		o.sample[i] = s
+	}
+}
+
+/*
+ * Take the files picked by Sample in the order they've been found, so IDs follow the walk
+ */
+func (o *organizer) takeSample() {
+	sort.Slice(o.sample, func(a, b int) bool { return o.sample[a].seq < o.sample[b].seq })
+	o.res.Sampled = len(o.sample)
+	for i, s := range o.sample {
+		if o.canceled() {
+			o.mu.Lock()
+			o.dropped += len(o.sample) - i
+			o.mu.Unlock()
+			return
+		}
+		if o.maxReached() {
+			return
+		}
+		o.root, o.in = s.root, s.in
+		o.takeFile(s.from, s.filename, s.ext, s.info, s.to)
+	}
+}
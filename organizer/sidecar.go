@@ -0,0 +1,122 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Copy sidecar files holding edits along with their images
+ */
+
+package organizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// extensions of sidecar files, XMP of Lightroom, darktable and others, AAE of Apple Photos
+var sidecarExts = []string{".xmp", ".aae"}
+
+// a sidecar file found next to an image
+type sidecar struct {
+	path string      // sidecar file
+	ext  string      // lowercase extension of the sidecar
+	full bool        // named after the image with its extension, e.g. IMG_1.JPG.xmp
+	info os.FileInfo // of path
+}
+
+/*
+ * Find the sidecar files of an image in its directory
+ * both "IMG_1.xmp" and "IMG_1.JPG.xmp" are found, extensions in lower or upper case
+ */
+func findSidecars(from string) []sidecar {
+	var base string = strings.TrimSuffix(from, filepath.Ext(from))
+	var found []sidecar
+	for _, ext := range sidecarExts {
+		for _, candidate := range []sidecar{
+			{path: base + ext, ext: ext}, {path: base + strings.ToUpper(ext), ext: ext},
+			{path: from + ext, ext: ext, full: true}, {path: from + strings.ToUpper(ext), ext: ext, full: true},
+		} {
+			info, err := os.Stat(candidate.path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			var seen bool = false // a case-insensitive filesystem finds the same file twice
+			for _, prev := range found {
+				seen = seen || os.SameFile(prev.info, info)
+			}
+			if !seen {
+				candidate.info = info
+				found = append(found, candidate)
+			}
+		}
+	}
+	return found
+}
+
+/*
+ * Name a sidecar after the copy of its image, see copySidecars
+ */
+func sidecarDest(j job, s sidecar) string {
+	if s.full { // after the whole name of the copy
+		return j.to + s.ext
+	}
+	return strings.TrimSuffix(j.to, filepath.Ext(j.to)) + s.ext
+}
+
+/*
+ * Copy the sidecar files of a job's image next to its copy, named like it
+ * e.g. IMG_1.xmp becomes 1.xmp for 1.jpg, IMG_1.JPG.xmp becomes 1.jpg.xmp
+ * an existing sidecar of that name is replaced, it belonged to a file that's been replaced as well
+ * sources are removed with Move like the image, copies are recorded in the manifest and state file like it, so Undo brings them back
+ * @param buf copy buffer of the worker
+ */
+func (o *organizer) copySidecars(j job, buf []byte) {
+	for _, s := range findSidecars(j.from) {
+		var to string = sidecarDest(j, s)
+		var modTime time.Time // like the image, see processFile
+		if !o.cfg.NoTime {
+			modTime = s.info.ModTime()
+		}
+		var mode os.FileMode
+		if !o.cfg.NoPerm {
+			mode = s.info.Mode().Perm()
+		}
+		var h hash.Hash // for the manifest
+		if o.manifest != nil {
+			h = sha256.New()
+		}
+		written, err := copyFile(o.ctx, s.path, to, modTime, mode, h, buf, o.limiter, nil)
+		if errors.Is(err, ErrCanceled) {
+			return
+		}
+		if err != nil {
+			o.fail(j.in, err, slog.String("source", s.path), slog.String("destination", to))
+			continue
+		}
+		o.logf(LOG_INFO, "\"%s\",\"%s\"", slog.String("source", s.path), slog.String("destination", to))
+		var sum string
+		if h != nil {
+			sum = hex.EncodeToString(h.Sum(nil))
+		}
+		o.mu.Lock()
+		o.res.Sidecars++ // record how many sidecars were copied
+		var errState error = o.record(s.path, to, written, sum, s.info)
+		o.mu.Unlock()
+		o.warnState(errState)
+		if o.cfg.Move {
+			if err := os.Remove(s.path); err != nil {
+				o.mu.Lock()
+				o.res.Failed++ // record this incident
+				o.res.RemoveError++
+				o.res.FailedIn[j.in]++
+				o.mu.Unlock()
+				o.logf(LOG_ERROR, "%s", slog.Any("error", err), slog.String("source", s.path))
+			}
+		}
+	}
+}
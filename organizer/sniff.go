@@ -0,0 +1,58 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Detect image types by content
+ */
+
+package organizer
+
+import (
+	"io"
+	"net/http"
+	"os"
+)
+
+// image and video types detected by http.DetectContentType -> extensions, the first one is used for copies
+var sniffExt = map[string][]string{
+	"image/jpeg":   {"jpg", "jpeg"},
+	"image/png":    {"png"},
+	"image/gif":    {"gif"},
+	"image/bmp":    {"bmp"},
+	"image/webp":   {"webp"},
+	"image/x-icon": {"ico"},
+	"video/mp4":    {"mp4", "m4v"},
+	"video/avi":    {"avi"},
+	"video/webm":   {"mkv", "webm"}, // Matroska, WebM is based on it
+}
+
+/*
+ * Detect the content type of a file from its first 512 bytes
+ * the file is opened separately, so copyFile() still reads it from the start
+ * @see https://golang.org/pkg/net/http/#DetectContentType
+ */
+func sniffType(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	var buf = make([]byte, 512)
+	n, err := io.ReadFull(in, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF { // short files are fine
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+/*
+ * Check whether ext (lowercase, with leading dot) is one of exts (without dot)
+ */
+func hasExt(exts []string, ext string) bool {
+	for _, e := range exts {
+		if "."+e == ext {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Free space of a filesystem, not supported on this platform
+ */
+
+package organizer
+
+import "errors"
+
+/*
+ * Get the number of bytes available on the filesystem of path
+ * not supported here, the free-space check is skipped
+ */
+func freeSpace(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("free space check is not supported on this platform")
+}
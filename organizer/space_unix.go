@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Free space of a filesystem on Unix
+ */
+
+package organizer
+
+import "syscall"
+
+/*
+ * Get the number of bytes available to unprivileged users on the filesystem of path
+ * @return free bytes and the size of the filesystem
+ */
+func freeSpace(path string) (uint64, uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
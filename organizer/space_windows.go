@@ -0,0 +1,34 @@
+//go:build windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Free space of a filesystem on Windows
+ */
+
+package organizer
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+/*
+ * Get the number of bytes available to the current user on the volume of path
+ * @return free bytes and the size of the volume
+ * @see https://learn.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-getdiskfreespaceexw
+ */
+func freeSpace(path string) (uint64, uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free, total uint64
+	r, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), uintptr(unsafe.Pointer(&total)), 0)
+	if r == 0 {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
@@ -0,0 +1,80 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Remember copied files across runs, so an interrupted run can be resumed
+ */
+
+package organizer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// a source file recorded in a state file
+type stateEntry struct {
+	size    int64 // size in bytes when it was copied
+	modTime int64 // modification time when it was copied, in nanoseconds since the Unix epoch
+}
+
+/*
+ * Load the sources recorded in a state file
+ * each line is "source,size,modification time", a line cut off by a crash is skipped,
+ * a source recorded again later wins
+ * @return empty map if the file doesn't exist yet
+ */
+func loadState(path string) (map[string]stateEntry, error) {
+	var done = make(map[string]stateEntry)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) { // first run
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return done, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) { // e.g. cut off in a quoted path
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) != 3 {
+			continue
+		}
+		size, errSize := strconv.ParseInt(record[1], 10, 64)
+		modTime, errTime := strconv.ParseInt(record[2], 10, 64)
+		if errSize != nil || errTime != nil {
+			continue
+		}
+		done[record[0]] = stateEntry{size, modTime}
+	}
+}
+
+/*
+ * Record a copied source in a state file, written through right away so an interrupted run keeps it
+ * @param info source file
+ */
+func writeState(w *csv.Writer, from string, info os.FileInfo) error {
+	w.Write([]string{from, strconv.FormatInt(info.Size(), 10), strconv.FormatInt(info.ModTime().UnixNano(), 10)})
+	w.Flush()
+	return w.Error()
+}
+
+/*
+ * Check whether a source is still the file recorded in a state file
+ */
+func (e stateEntry) matches(info os.FileInfo) bool {
+	return info != nil && e.size == info.Size() && e.modTime == info.ModTime().UnixNano()
+}
@@ -0,0 +1,205 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Render output filenames from a template
+ */
+
+package organizer
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholders supported by Config.Template
+var templateFields = []string{"seq", "ext", "parent", "name", "date", "year", "month", "day", "camera", "lens", "iso", "shutter", "fnumber", "focal"}
+
+// placeholders read from the EXIF data of a JPEG, see fillExif
+var templateExifFields = []string{"camera", "lens", "iso", "shutter", "fnumber", "focal"}
+
+// value of an EXIF placeholder whose tag is missing, e.g. in a PNG or a scan
+const templateUnknown = "unknown"
+
+// values of the placeholders for a single file
+type templateData struct {
+	seq    string // sequential ID, zero-padded to Pad
+	ext    string // extension with leading dot
+	parent string // name of the parent folder
+	name   string // original filename without extension
+	date   string // YYYY-MM-DD from EXIF or modification time
+	year   string // YYYY of date
+	month  string // MM of date
+	day    string // DD of date
+
+	// from EXIF, see fillExif
+	camera  string // make and model like "Canon-EOS-5D", spaces replaced by "-"
+	lens    string // lens model, spaces replaced by "-"
+	iso     string // ISO speed like "100"
+	shutter string // exposure time like "1-250s" or "2s"
+	fnumber string // aperture like "f2.8"
+	focal   string // focal length like "50mm"
+}
+
+/*
+ * Check that a template only uses known placeholders
+ */
+func checkTemplate(tmpl string) error {
+	var rest string = tmpl
+	for {
+		var start int = strings.Index(rest, "{")
+		if start < 0 {
+			return nil
+		}
+		var end int = strings.Index(rest[start:], "}")
+		if end < 0 {
+			return fmt.Errorf("template %q: missing \"}\"", tmpl)
+		}
+		var field string = rest[start+1 : start+end]
+		var known bool = false
+		for _, f := range templateFields {
+			known = known || f == field
+		}
+		if !known {
+			return fmt.Errorf("template %q: unknown placeholder {%s}", tmpl, field)
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+/*
+ * Render a template into a single filename
+ * the result is sanitized, so a "/" in the template or in a value never creates sub-folders
+ */
+func renderTemplate(tmpl string, d templateData) string {
+	return sanitize(strings.NewReplacer(
+		"{seq}", d.seq,
+		"{ext}", d.ext,
+		"{parent}", d.parent,
+		"{name}", d.name,
+		"{date}", d.date,
+		"{year}", d.year,
+		"{month}", d.month,
+		"{day}", d.day,
+		"{camera}", d.camera,
+		"{lens}", d.lens,
+		"{iso}", d.iso,
+		"{shutter}", d.shutter,
+		"{fnumber}", d.fnumber,
+		"{focal}", d.focal,
+	).Replace(tmpl))
+}
+
+/*
+ * Check a directory structure like "{year}/{month}/{ext}", see Config.Structure
+ * the placeholders are those of a filename template but {seq}, every file would get a folder of its own
+ */
+func checkStructure(tmpl string) error {
+	if err := checkTemplate(tmpl); err != nil {
+		return err
+	}
+	if strings.Contains(tmpl, "{seq}") {
+		return fmt.Errorf("structure %q: {seq} can't name a directory", tmpl)
+	}
+	return nil
+}
+
+/*
+ * Render a directory structure into a relative path
+ * each "/"-separated segment is rendered and sanitized on its own, {ext} is without dot like with ByExt,
+ * empty segments are dropped and "." or ".." can't climb out of the output directory
+ * @return "" if every segment is empty
+ */
+func renderStructure(tmpl string, d templateData) string {
+	d.ext = strings.TrimPrefix(d.ext, ".")
+	var dirs []string
+	for _, segment := range strings.Split(tmpl, "/") {
+		var dir string = strings.TrimSpace(renderTemplate(segment, d))
+		if dir == "." || dir == ".." {
+			dir = strings.Repeat("_", len(dir))
+		}
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return filepath.Join(dirs...)
+}
+
+/*
+ * Fill the placeholders of a template that have to be read from the file, those already set are kept
+ * so the same data can be used for Structure and Template
+ * @param path file to read the date and EXIF data from
+ * @param ext  extension with leading dot, photoDate only reads EXIF of JPEG files
+ * @param info file info, for the modification time if there's no EXIF date
+ */
+func (d *templateData) fill(tmpl string, path string, ext string, info os.FileInfo) {
+	if d.date == "" && (strings.Contains(tmpl, "{date}") || strings.Contains(tmpl, "{year}") || strings.Contains(tmpl, "{month}") || strings.Contains(tmpl, "{day}")) {
+		var date time.Time = photoDate(path, ext, info)
+		d.date, d.year, d.month, d.day = date.Format("2006-01-02"), date.Format("2006"), date.Format("01"), date.Format("02")
+	}
+	if d.camera == "" && usesExif(tmpl) {
+		d.fillExif(path)
+	}
+}
+
+/*
+ * Check whether a template uses any EXIF placeholder, so the EXIF data has to be read
+ */
+func usesExif(tmpl string) bool {
+	for _, f := range templateExifFields {
+		if strings.Contains(tmpl, "{"+f+"}") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Fill the EXIF placeholders of a file, those without a tag become templateUnknown
+ * @param path JPEG file, the EXIF data of other types isn't read
+ */
+func (d *templateData) fillExif(path string) {
+	d.camera, d.lens, d.iso, d.shutter, d.fnumber, d.focal = templateUnknown, templateUnknown, templateUnknown, templateUnknown, templateUnknown, templateUnknown
+	entries, err := readExif(path)
+	if err != nil {
+		return
+	}
+	// the model often starts with the make already, e.g. "Canon" and "Canon EOS 5D", but not "NIKON CORPORATION" and "D750"
+	var maker, model string = exifString(entries, exifTagMake), exifString(entries, exifTagModel)
+	if brand := strings.Fields(maker); len(brand) > 0 && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(brand[0])) {
+		model = strings.TrimSpace(brand[0] + " " + model)
+	}
+	if model != "" {
+		d.camera = strings.Join(strings.Fields(model), "-")
+	}
+	if lens := exifString(entries, exifTagLensModel); lens != "" {
+		d.lens = strings.Join(strings.Fields(lens), "-")
+	}
+	if iso, ok := exifUint(entries, exifTagISO); ok && iso > 0 {
+		d.iso = strconv.FormatUint(uint64(iso), 10)
+	}
+	if t, ok := exifRational(entries, exifTagExposureTime); ok && t > 0 {
+		if t < 1 { // written as a fraction, "/" isn't allowed in filenames
+			d.shutter = fmt.Sprintf("1-%ds", int(math.Round(1/t)))
+		} else {
+			d.shutter = formatDecimal(t) + "s"
+		}
+	}
+	if f, ok := exifRational(entries, exifTagFNumber); ok && f > 0 {
+		d.fnumber = "f" + formatDecimal(f)
+	}
+	if f, ok := exifRational(entries, exifTagFocalLength); ok && f > 0 {
+		d.focal = formatDecimal(f) + "mm"
+	}
+}
+
+/*
+ * Format a number with at most one decimal, e.g. "2.8" or "8"
+ */
+func formatDecimal(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
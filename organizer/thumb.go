@@ -0,0 +1,92 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Write scaled down copies of JPEG and PNG images
+ */
+
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// returned, wrapped, by thumbFile if the source can't be decoded, it's copied as it is then
+var errNoThumb = errors.New("can't decode image for a thumbnail")
+
+// quality of JPEG thumbnails
+const thumbQuality int = 85
+
+/*
+ * Write a thumbnail of an image that fits into a box of width x height
+ * the aspect ratio is kept and images are never scaled up, the thumbnail is
+ * encoded in the format of the source and written atomically like copyFile()
+ * @param orientation EXIF orientation of the source, applied before scaling if > 1
+ * @param modTime     set as access and modification time of the thumbnail, zero value leaves it untouched
+ * @param mode        permission bits of the thumbnail, 0 for 0644
+ * @param h           if not nil, the thumbnail is written to h as well
+ * @return size of the thumbnail
+ */
+func thumbFile(ctx context.Context, from string, to string, width int, height int, orientation int, modTime time.Time, mode os.FileMode, h hash.Hash) (written int64, err error) {
+	in, err := os.Open(longPath(from))
+	if err != nil {
+		return 0, err
+	}
+	src, format, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return 0, fmt.Errorf("%w %s: %s", errNoThumb, from, err)
+	}
+	if format != "jpeg" && format != "png" { // decoders registered for other reasons, e.g. GIF by dim.go, have no encoder here
+		return 0, fmt.Errorf("%w %s: %s isn't supported", errNoThumb, from, format)
+	}
+	if ctx.Err() != nil { // decoding a large image takes a while
+		return 0, ErrCanceled
+	}
+	if orientation > 1 { // turn upright before scaling, the thumbnail carries no EXIF
+		src = orient(src, orientation)
+	}
+	var dst image.Image = scale(src, width, height)
+	return writeAtomic(to, modTime, mode, h, func(w io.Writer) error {
+		if format == "png" {
+			return png.Encode(w, dst)
+		}
+		return jpeg.Encode(w, dst, &jpeg.Options{Quality: thumbQuality})
+	})
+}
+
+/*
+ * Scale an image down to fit into width x height with Catmull-Rom resampling
+ * @return src itself if it fits already
+ */
+func scale(src image.Image, width int, height int) image.Image {
+	var b image.Rectangle = src.Bounds()
+	var sw, sh int = b.Dx(), b.Dy()
+	if sw <= width && sh <= height {
+		return src
+	}
+	// keep aspect ratio, the tighter side decides
+	var dw, dh int = width, sh * width / sw
+	if dh > height {
+		dw, dh = sw*height/sh, height
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	var dst = image.NewRGBA(image.Rect(0, 0, dw, dh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
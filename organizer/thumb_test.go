@@ -0,0 +1,79 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of scaling thumbnails
+ */
+
+package organizer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScale(t *testing.T) {
+	var tests = []struct {
+		w, h          int // source
+		width, height int // box
+		dw, dh        int // thumbnail
+	}{
+		{400, 100, 100, 100, 100, 25}, // wide
+		{100, 400, 100, 100, 25, 100}, // tall
+		{640, 480, 320, 320, 320, 240},
+		{640, 480, 320, 100, 133, 100}, // height is tighter
+		{30, 20, 100, 100, 30, 20},     // fits already, never scaled up
+		{1000, 2, 100, 100, 100, 1},    // at least a pixel
+	}
+	for _, tt := range tests {
+		var src = image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+		var b image.Rectangle = scale(src, tt.width, tt.height).Bounds()
+		if b.Dx() != tt.dw || b.Dy() != tt.dh {
+			t.Errorf("%dx%d into %dx%d: %dx%d, want %dx%d", tt.w, tt.h, tt.width, tt.height, b.Dx(), b.Dy(), tt.dw, tt.dh)
+		}
+	}
+	// colors survive, a plain red image stays red
+	var src = image.NewRGBA(image.Rect(10, 10, 210, 110)) // bounds not at the origin
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+3] = 255, 255
+	}
+	var dst image.Image = scale(src, 50, 50)
+	if r, g, b, a := dst.At(10, 5).RGBA(); r>>8 != 255 || g != 0 || b != 0 || a>>8 != 255 {
+		t.Errorf("red scaled to %v", dst.At(10, 5))
+	}
+}
+
+func TestThumbFile(t *testing.T) {
+	var dir string = t.TempDir()
+	var from, to string = filepath.Join(dir, "a.png"), filepath.Join(dir, "thumb.png")
+	var img = image.NewRGBA(image.Rect(0, 0, 300, 100))
+	img.Set(0, 0, color.White)
+	f, err := os.Create(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err = thumbFile(context.Background(), from, to, 60, 60, 1, time.Time{}, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err = os.Open(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" || cfg.Width != 60 || cfg.Height != 20 {
+		t.Errorf("thumbnail is a %dx%d %s, want a 60x20 png", cfg.Width, cfg.Height, format)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix && !windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Errors worth a retry, only timeouts on other platforms
+ */
+
+package organizer
+
+import (
+	"errors"
+	"os"
+)
+
+/*
+ * Check whether an error looks like it may go away on a second attempt
+ * errors have no numbers to tell them apart here, e.g. on Plan 9, so only timeouts are retried
+ */
+func isTransient(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
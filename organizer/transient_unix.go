@@ -0,0 +1,28 @@
+//go:build unix
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Errors worth a retry on Unix
+ */
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+/*
+ * Check whether an error looks like it may go away on a second attempt,
+ * e.g. an I/O error or a timeout on a network share
+ * missing files or permissions are not retried
+ */
+func isTransient(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EIO, syscall.EAGAIN, syscall.EBUSY, syscall.ETIMEDOUT, syscall.ECONNRESET, syscall.ESTALE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
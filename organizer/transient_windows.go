@@ -0,0 +1,38 @@
+//go:build windows
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Errors worth a retry on Windows
+ */
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes the syscall package has no names for
+const (
+	errSharingViolation syscall.Errno = 32   // ERROR_SHARING_VIOLATION, e.g. a scanner still writing the file
+	errLockViolation    syscall.Errno = 33   // ERROR_LOCK_VIOLATION
+	errUnexpNetErr      syscall.Errno = 59   // ERROR_UNEXP_NET_ERR
+	errNetnameDeleted   syscall.Errno = 64   // ERROR_NETNAME_DELETED, the share went away for a moment
+	errSemTimeout       syscall.Errno = 121  // ERROR_SEM_TIMEOUT
+	errIODevice         syscall.Errno = 1117 // ERROR_IO_DEVICE
+)
+
+/*
+ * Check whether an error looks like it may go away on a second attempt,
+ * e.g. an I/O error or a timeout on a network share
+ * missing files or permissions are not retried
+ */
+func isTransient(err error) bool {
+	for _, errno := range []syscall.Errno{errSharingViolation, errLockViolation, errUnexpNetErr, errNetnameDeleted, errSemTimeout, errIODevice} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
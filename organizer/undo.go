@@ -0,0 +1,149 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Undo a run from the manifest it wrote
+ */
+
+package organizer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// result of Undo
+type UndoResult struct {
+	Removed  int `json:"removed"`  // copies removed
+	Restored int `json:"restored"` // copies moved back to their source with Move
+	Changed  int `json:"changed"`  // copies kept because their content differs from the manifest, e.g. edited since
+	Missing  int `json:"missing"`  // copies that don't exist anymore
+	Failed   int `json:"failed"`   // copies that couldn't be removed or restored
+}
+
+/*
+ * Undo a run by removing every copy recorded in its manifest, see Config.Manifest
+ * a copy is only removed if its size and SHA-256 still match the manifest, so edits made since are kept,
+ * rows without destination, written in scan-only mode, are skipped
+ * with cfg.Move, a copy whose source is gone is moved back instead, like the run did the other way
+ * note: only Move, Stdout, Stderr, LogLevel, Logger and ErrLog of cfg are used
+ * @return an error if the manifest can't be read, or ErrCanceled if ctx was done
+ */
+func Undo(ctx context.Context, manifest io.Reader, cfg Config) (UndoResult, error) {
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Stderr == nil {
+		cfg.Stderr = os.Stderr
+	}
+	var res UndoResult
+	r, err := readManifest(manifest)
+	if err != nil {
+		return res, err
+	}
+	var buf = make([]byte, DefaultBufSize)
+	for {
+		if ctx.Err() != nil {
+			return res, fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+		}
+		record, err := r.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		var from, to, hash string = record[0], record[1], record[3]
+		if to == "" { // found in scan-only mode, nothing was copied
+			continue
+		}
+		size, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return res, fmt.Errorf("invalid size %q of %s in manifest", record[2], to)
+		}
+		// make sure the copy is still the file the run wrote
+		info, err := os.Stat(to)
+		if os.IsNotExist(err) {
+			res.Missing++ // record this incident
+			logf(cfg, LOG_INFO, "missing %s", slog.String("destination", to))
+			continue
+		}
+		var current string
+		if err == nil && info.Size() == size {
+			current, err = hashFile(to)
+		}
+		if err != nil {
+			res.Failed++ // record this incident
+			logf(cfg, LOG_ERROR, "%s", slog.Any("error", err), slog.String("destination", to))
+			continue
+		}
+		if current != hash {
+			res.Changed++ // record this incident
+			logf(cfg, LOG_ERROR, "keep %s, it has changed since it was copied", slog.String("destination", to))
+			continue
+		}
+		// move back files whose source was moved away
+		if _, err := os.Lstat(from); cfg.Move && os.IsNotExist(err) {
+			err = restore(ctx, to, from, info, buf)
+			if err != nil {
+				res.Failed++ // record this incident
+				logf(cfg, LOG_ERROR, "%s", slog.Any("error", err), slog.String("source", to), slog.String("destination", from))
+				continue
+			}
+			res.Restored++ // record this incident
+			logf(cfg, LOG_INFO, "restore \"%s\",\"%s\"", slog.String("source", to), slog.String("destination", from))
+			continue
+		}
+		err = os.Remove(to)
+		if err != nil {
+			res.Failed++ // record this incident
+			logf(cfg, LOG_ERROR, "%s", slog.Any("error", err), slog.String("destination", to))
+			continue
+		}
+		res.Removed++ // record this incident
+		logf(cfg, LOG_INFO, "remove %s", slog.String("destination", to))
+	}
+}
+
+/*
+ * Read the header of a manifest written by Config.Manifest
+ * @return reader positioned at the first row, or an error if it isn't a manifest
+ */
+func readManifest(manifest io.Reader) (*csv.Reader, error) {
+	r := csv.NewReader(manifest)
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) != 4 || header[1] != "destination" || header[3] != "sha256" {
+		return nil, errors.New("not a manifest, expected columns source,destination,size,sha256")
+	}
+	return r, nil
+}
+
+/*
+ * Move a copy back to where its source was
+ * renamed if possible, copied and removed across devices
+ * @param info of the copy, its modification time and permission bits are kept
+ */
+func restore(ctx context.Context, from string, to string, info os.FileInfo, buf []byte) error {
+	err := os.MkdirAll(filepath.Dir(to), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(from, to)
+	if !isCrossDevice(err) {
+		return err
+	}
+	_, err = copyFile(ctx, from, to, info.ModTime(), info.Mode().Perm(), nil, buf, nil, nil)
+	if err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,71 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Tests of undoing a run from its manifest
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUndoMoveSidecars(t *testing.T) {
+	// a moved sidecar is only in the output directory, Undo has to bring it back along with its image
+	var in, out string = t.TempDir(), t.TempDir()
+	var files = []string{"IMG_1.JPG", "IMG_1.xmp", "IMG_2.jpg", "IMG_2.jpg.xmp", "notes.txt"}
+	writeTree(t, in, files...)
+	var manifest bytes.Buffer
+	res := organize(t, Config{In: []string{in}, Out: out, Ext: []string{"jpg"}, Depth: 1, Move: true, Sidecars: true, Manifest: &manifest})
+	if res.Moved != 2 || res.Sidecars != 2 || res.Failed != 0 {
+		t.Fatalf("moved %d, sidecars %d, failed %d, want 2, 2, 0", res.Moved, res.Sidecars, res.Failed)
+	}
+	if got, want := listTree(t, in), []string{"notes.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("input after the run %v, want %v", got, want)
+	}
+	if got, want := listTree(t, out), []string{"1.jpg", "1.xmp", "2.jpg", "2.jpg.xmp"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("output %v, want %v", got, want)
+	}
+
+	undo, err := Undo(context.Background(), &manifest, Config{Move: true, Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undo.Restored != 4 || undo.Failed != 0 || undo.Missing != 0 || undo.Changed != 0 {
+		t.Errorf("undo %+v, want 4 restored", undo)
+	}
+	if got := listTree(t, in); !reflect.DeepEqual(got, []string{"IMG_1.JPG", "IMG_1.xmp", "IMG_2.jpg", "IMG_2.jpg.xmp", "notes.txt"}) {
+		t.Errorf("input after undo %v, want %v", got, files)
+	}
+	for _, name := range files {
+		if data, err := os.ReadFile(filepath.Join(in, name)); err != nil || string(data) != name {
+			t.Errorf("%s restored with %q, %v", name, data, err)
+		}
+	}
+	if got := listTree(t, out); len(got) != 0 {
+		t.Errorf("output after undo %v, want empty", got)
+	}
+}
+
+func TestSidecarsState(t *testing.T) {
+	// sidecars are recorded in the state file along with their images
+	var in, out string = t.TempDir(), t.TempDir()
+	writeTree(t, in, "IMG_1.jpg", "IMG_1.xmp")
+	var state string = filepath.Join(t.TempDir(), "state.csv")
+	organize(t, Config{In: []string{in}, Out: out, Ext: []string{"jpg"}, Depth: 1, Sidecars: true, State: state})
+	done, err := loadState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"IMG_1.jpg", "IMG_1.xmp"} {
+		if _, ok := done[filepath.Join(in, name)]; !ok {
+			t.Errorf("%s not recorded in state, got %v", name, done)
+		}
+	}
+}
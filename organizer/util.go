@@ -0,0 +1,87 @@
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Helpers for sizes and filenames
+ */
+
+package organizer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Parse a human-readable size like "100KB" or "2MB" into bytes
+ * suffixes B, KB, MB and GB are case-insensitive and based on 1024, a bare number means bytes
+ */
+func ParseSize(size string) (int64, error) {
+	var s string = strings.ToUpper(strings.TrimSpace(size))
+	var unit int64 = 1
+	for _, suffix := range []struct {
+		name string
+		mul  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, suffix.name) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, suffix.name))
+			unit = suffix.mul
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+/*
+ * Format a number of bytes human-readable like "3.4 GB"
+ * units are based on 1024 like ParseSize
+ */
+func FormatSize(size int64) string {
+	if size < 1<<10 {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	var value float64 = float64(size) / (1 << 10)
+	var units = []string{"KB", "MB", "GB", "TB"}
+	var i int = 0
+	for ; value >= 1<<10 && i < len(units)-1; i++ {
+		value /= 1 << 10
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+/*
+ * Make a string safe to use as part of a single filename
+ * path separators and other characters not allowed on common filesystems are replaced by "_"
+ */
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// hex digits of SHA-256 used for names by HashName, 64 bits make a collision unlikely even for millions of files
+const hashNameLen = 16
+
+// hex digits of SHA-256 appended to colliding names with Collision "hash", only names of the same spelling have to differ
+const collisionHashLen = 8
+
+// spellings of the same file type and the one used for copies with NormExt
+var extAliases = map[string]string{".jpeg": ".jpg", ".jpe": ".jpg", ".jfif": ".jpg", ".tif": ".tiff"}
+
+/*
+ * Get the usual spelling of a lowercase extension, e.g. .jpg for .jpeg
+ * @return ext itself if it has no other spelling
+ */
+func normExt(ext string) string {
+	if alias, ok := extAliases[ext]; ok {
+		return alias
+	}
+	return ext
+}
@@ -0,0 +1,75 @@
+//go:build darwin
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Copy extended attributes on macOS
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+/*
+ * Copy the extended attributes of from to to, e.g. Finder tags and ratings of a photo manager
+ * macOS has no namespaces, all are copied but those of com.apple.system, which need privileges
+ * and belong to the system the file was on
+ * @return an error matching errors.ErrUnsupported if either filesystem has no xattrs
+ */
+func copyXattrs(from string, to string) error {
+	names, err := readXattr(func(buf []byte) (int, error) { return xattrCall(syscall.SYS_LISTXATTR, from, "", buf) })
+	if err != nil {
+		return err
+	}
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 || strings.HasPrefix(string(name), "com.apple.system.") { // the list ends with a NUL, so the last one is empty
+			continue
+		}
+		value, err := readXattr(func(buf []byte) (int, error) { return xattrCall(syscall.SYS_GETXATTR, from, string(name), buf) })
+		if err != nil {
+			return err
+		}
+		_, err = xattrCall(syscall.SYS_SETXATTR, to, string(name), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Call listxattr, getxattr or setxattr, the syscall package has no wrappers for them on macOS
+ * listxattr(path, buf, size, options), getxattr and setxattr(path, name, buf, size, position, options)
+ * @param name attribute name, ignored by listxattr
+ * @return size of the list or value
+ */
+func xattrCall(trap uintptr, path string, name string, buf []byte) (int, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var data *byte
+	if len(buf) > 0 {
+		data = &buf[0]
+	}
+	var r uintptr
+	var errno syscall.Errno
+	if trap == syscall.SYS_LISTXATTR {
+		r, _, errno = syscall.Syscall6(trap, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(data)), uintptr(len(buf)), 0, 0, 0)
+	} else {
+		n, err := syscall.BytePtrFromString(name)
+		if err != nil {
+			return 0, err
+		}
+		r, _, errno = syscall.Syscall6(trap, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)), uintptr(unsafe.Pointer(data)), uintptr(len(buf)), 0, 0)
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
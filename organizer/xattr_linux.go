@@ -0,0 +1,41 @@
+//go:build linux
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Copy extended attributes on Linux
+ */
+
+package organizer
+
+import (
+	"bytes"
+	"syscall"
+)
+
+/*
+ * Copy the extended attributes of from to to, e.g. ratings and tags of a photo manager
+ * only the user namespace is copied, security and trusted attributes need privileges
+ * and belong to the system the file was on
+ * @return an error matching errors.ErrUnsupported if either filesystem has no xattrs
+ */
+func copyXattrs(from string, to string) error {
+	names, err := readXattr(func(buf []byte) (int, error) { return syscall.Listxattr(from, buf) })
+	if err != nil {
+		return err
+	}
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if !bytes.HasPrefix(name, []byte("user.")) { // the list ends with a NUL, so the last one is empty
+			continue
+		}
+		value, err := readXattr(func(buf []byte) (int, error) { return syscall.Getxattr(from, string(name), buf) })
+		if err != nil {
+			return err
+		}
+		err = syscall.Setxattr(to, string(name), value, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Extended attributes, not supported on this platform
+ */
+
+package organizer
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+ * Copy all extended attributes of from to to
+ * not supported here, copies are made without them
+ */
+func copyXattrs(from string, to string) error {
+	return fmt.Errorf("extended attributes on this platform: %w", errors.ErrUnsupported)
+}
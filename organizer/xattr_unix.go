@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+/*
+ * Image Organizer
+ * @author Benjamin Lee
+ * @description Extended attributes on Linux and macOS
+ */
+
+package organizer
+
+import "syscall"
+
+/*
+ * Read a list or value of unknown size, asking for the size first
+ * the size is asked again if it grew in the meantime
+ */
+func readXattr(read func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		var buf = make([]byte, size)
+		size, err = read(buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}